@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 
@@ -35,9 +36,10 @@ func main() {
 	}
 	fmt.Printf("Passed webhook ping test!\n")
 
-	// err = client.Disconnect()
-	// if err != nil {
-	// 	log.Fatalf("%+v", err)
-	// }
+	err = client.Disconnect(context.TODO())
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	fmt.Printf("Client disconnected!\n")
 	fmt.Printf("The End.\n")
 }
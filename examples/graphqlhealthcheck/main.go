@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	g "github.com/desteves/realm/pkg/graphql"
@@ -37,10 +38,11 @@ func main() {
 	}
 	fmt.Printf("Passed healthcheck test, got %+v \n", r)
 
-	// err = client.Disconnect()
-	// if err != nil {
-	// 	log.Fatalf("%+v", err)
-	// }
+	err = client.Disconnect(context.TODO())
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	fmt.Printf("Client disconnected!\n")
 	fmt.Printf("The End.\n")
 
 }
@@ -12,6 +12,14 @@ import (
 
 type jsondict map[string]interface{}
 
+// CustomerInsertInput mirrors the input type generated by Realm for the customers collection.
+type CustomerInsertInput struct {
+	Active   bool   `json:"active"`
+	Address  string `json:"address"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
 func main() {
 
 	appid := "graphqlserver-lrnqt" // please don't ddos my poor little app, leaving it open so y'all can test etc.
@@ -55,14 +63,14 @@ func runQuery(client *g.Client, about string, query interface{}, variables map[s
 		fmt.Printf("! err %+v \n", err.Error())
 		return
 	}
-	fmt.Printf("%+v \n", response)
+	fmt.Printf("%+v \n", query)
 }
 
 func runMutation(client *g.Client, about string, mutation string, variables map[string]interface{}) {
 
 	var response g.Response
 	fmt.Printf("\n%v", about)
-	err := client.Mutate(context.TODO(), mutation, variables, &response)
+	err := client.MutateRaw(context.TODO(), mutation, variables, &response)
 	if err != nil {
 		fmt.Printf("! err %+v \n", err.Error())
 		return
@@ -80,7 +88,7 @@ func runSampleQueries(client *g.Client) {
 			URI  string `graphql:"listing_url"`
 		} `graphql:"listingsAndReviews"`
 	}
-	runQuery(client, "(01) Query Resolver findOne AirBnB Review\n", qOne, nil)
+	runQuery(client, "(01) Query Resolver findOne AirBnB Review\n", &qOne, nil)
 
 	// findOne with filter
 	var qTwo struct {
@@ -90,7 +98,7 @@ func runSampleQueries(client *g.Client) {
 			URI  string `graphql:"listing_url"`
 		} `graphql:"listingsAndReviews( query: { _id: \"10009999\" } )"`
 	}
-	runQuery(client, "(02) Query Resolver with filter on AirBnB reviews\n", qTwo, nil)
+	runQuery(client, "(02) Query Resolver with filter on AirBnB reviews\n", &qTwo, nil)
 
 	// find many with limit
 	var qThree struct {
@@ -100,7 +108,7 @@ func runSampleQueries(client *g.Client) {
 			URI  string `graphql:"listing_url"`
 		} `graphql:"listingsAndReviewss( limit: 3 )"`
 	}
-	runQuery(client, "(03) Query Resolver with limit on AirBnB Reviews\n", qThree, nil)
+	runQuery(client, "(03) Query Resolver with limit on AirBnB Reviews\n", &qThree, nil)
 
 	// find many with sort
 	var qFour struct {
@@ -109,10 +117,22 @@ func runSampleQueries(client *g.Client) {
 			AccountID string `graphql:"account_id"`
 		} `graphql:"accountss(sortBy: ACCOUNT_ID_ASC, limit: 5)"`
 	}
-	runQuery(client, "(04) Query Resolver with sort and limit on Accounts\n", qFour, nil)
+	runQuery(client, "(04) Query Resolver with sort and limit on Accounts\n", &qFour, nil)
 
 }
 
+func runTypedMutation(client *g.Client, about string, mutation interface{}, variables map[string]interface{}) {
+
+	var response g.Response
+	fmt.Printf("\n%v", about)
+	err := client.Mutate(context.TODO(), mutation, variables, &response)
+	if err != nil {
+		fmt.Printf("! err %+v \n", err.Error())
+		return
+	}
+	fmt.Printf("%+v \n", mutation)
+}
+
 func runSampleMutations(client *g.Client) {
 
 	// insertOne<collection> and return _id
@@ -288,6 +308,22 @@ func runSampleMutations(client *g.Client) {
 	}
 	runMutation(client, "(12) Mutation Resolver -   ", mEight, vEight)
 
+	// insertOne<collection> from a struct, same as (05)
+	var mNine struct {
+		InsertOneCustomer struct {
+			ID string `graphql:"_id"`
+		} `graphql:"insertOneCustomer(data: $customer)"`
+	}
+	vNine := g.Variable{
+		"customer": CustomerInsertInput{
+			Active:   false,
+			Address:  "123 4th st apt 5",
+			Name:     "diana",
+			Username: "d",
+		},
+	}
+	runTypedMutation(client, "(13) Typed Mutation Resolver -   ", &mNine, vNine)
+
 }
 
 // GraphiQL syntax for mutations
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// UnmarshalGraphQL parses the JSON-encoded GraphQL response data and stores
+// the result in the value pointed to by v.
+//
+// The value v must be a non-nil pointer to the same struct that was used to
+// construct the query. Struct fields are matched against the response keys
+// using the same rules as ConstructQuery, honouring `graphql:"..."` tags,
+// aliases and arguments, e.g. `graphql:"reviews: listingsAndReviewss( limit: 3 )"`
+// is read from the "reviews" key.
+func UnmarshalGraphQL(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("cannot unmarshal into non-pointer or nil %T", v)
+	}
+	return decode(data, rv.Elem())
+}
+
+// decode stores the raw JSON value data into v, recursing into structs and slices.
+func decode(data json.RawMessage, v reflect.Value) error {
+	if isNull(data) {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	// Scalars and custom types decode themselves.
+	if v.CanAddr() && v.Addr().Type().Implements(jsonUnmarshaler) {
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decode(data, v.Elem())
+	case reflect.Slice:
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := decode(item, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		return decodeStruct(fields, v)
+	default:
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+}
+
+// decodeStruct stores the JSON object fields into the struct v.
+// Embedded structs without a tag and inline fragments are decoded from the same object.
+func decodeStruct(fields map[string]json.RawMessage, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous { // unexported
+			continue
+		}
+		value, ok := f.Tag.Lookup("graphql")
+		if (f.Anonymous && !ok) || strings.HasPrefix(strings.TrimSpace(value), "...") {
+			fv := v.Field(i)
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() != reflect.Struct {
+				continue
+			}
+			if err := decodeStruct(fields, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		var key string
+		if ok {
+			key = responseKey(value)
+		} else {
+			key = parseMixedCaps(f.Name).toLowerCamelCase()
+		}
+		raw, found := fields[key]
+		if !found {
+			continue
+		}
+		if err := decode(raw, v.Field(i)); err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// responseKey returns the key under which a field described by the graphql tag
+// is found in the response, i.e. the alias if any, otherwise the field name.
+//
+// E.g., "reviews: listingsAndReviewss( limit: 3 )" -> "reviews".
+func responseKey(tag string) string {
+	if i := strings.IndexAny(tag, "(@{"); i >= 0 {
+		tag = tag[:i]
+	}
+	if i := strings.Index(tag, ":"); i >= 0 {
+		tag = tag[:i]
+	}
+	return strings.TrimSpace(tag)
+}
+
+func isNull(data json.RawMessage) bool {
+	return len(data) == 0 || bytes.Equal(bytes.TrimSpace(data), []byte("null"))
+}
@@ -27,13 +27,14 @@ func ConstructQuery(v interface{}, variables map[string]interface{}) string {
 
 }
 
-// func ConstructMutation(v interface{}, variables map[string]interface{}) string {
-// 	query := query(v)
-// 	if len(variables) > 0 {
-// 		return "mutation(" + queryArguments(variables) + ")" + query
-// 	}
-// 	return "mutation" + query
-// }
+// ConstructMutation takes the mutation interface along with any variables to produce a valid mutation in string format.
+func ConstructMutation(v interface{}, variables map[string]interface{}) string {
+	query := query(v)
+	if len(variables) > 0 {
+		return "mutation(" + queryArguments(variables) + ")" + query
+	}
+	return "mutation" + query
+}
 
 // queryArguments constructs a minified arguments string for variables.
 //
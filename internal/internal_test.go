@@ -0,0 +1,107 @@
+package internal
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type CustomerInsertInput struct {
+	Name string `json:"name"`
+}
+
+var _ = Describe("Internal", func() {
+	Describe("ConstructQuery", func() {
+		It("should build a minified query", func() {
+			var q struct {
+				Reviews []struct {
+					ID string `graphql:"_id"`
+				} `graphql:"listingsAndReviewss( limit: 3 )"`
+			}
+			Expect(ConstructQuery(q, nil)).Should(Equal(`{listingsAndReviewss( limit: 3 ){_id}}`))
+		})
+	})
+	Describe("ConstructMutation", func() {
+		var m struct {
+			InsertOneCustomer struct {
+				ID string `graphql:"_id"`
+			} `graphql:"insertOneCustomer(data:$customer)"`
+		}
+		It("should declare typed variables", func() {
+			variables := map[string]interface{}{"customer": CustomerInsertInput{Name: "diana"}}
+			Expect(ConstructMutation(&m, variables)).Should(Equal(`mutation($customer:CustomerInsertInput!){insertOneCustomer(data:$customer){_id}}`))
+		})
+		It("should omit the arguments without variables", func() {
+			Expect(ConstructMutation(m, nil)).Should(Equal(`mutation{insertOneCustomer(data:$customer){_id}}`))
+		})
+	})
+	Describe("UnmarshalGraphQL", func() {
+		Context("with a tagged query struct", func() {
+			var q struct {
+				Review struct {
+					ID   string `graphql:"_id"`
+					Name string
+				} `graphql:"listingsAndReviews( query: { _id: \"10009999\" } )"`
+				Reviews []struct {
+					ID string `graphql:"_id"`
+				} `graphql:"listingsAndReviewss( limit: 3 )"`
+				Top *struct {
+					AccountID int `graphql:"account_id"`
+				} `graphql:"top: accounts(sortBy: ACCOUNT_ID_ASC)"`
+				Missing *struct {
+					ID string `graphql:"_id"`
+				} `graphql:"missing"`
+			}
+			data := []byte(`{
+				"listingsAndReviews": {"_id": "10009999", "name": "Horto flat"},
+				"listingsAndReviewss": [{"_id": "1"}, {"_id": "2"}, {"_id": "3"}],
+				"top": {"account_id": 50948},
+				"missing": null
+			}`)
+
+			It("should decode every field", func() {
+				err := UnmarshalGraphQL(data, &q)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(q.Review.ID).Should(Equal("10009999"))
+				Expect(q.Review.Name).Should(Equal("Horto flat"))
+				Expect(q.Reviews).Should(HaveLen(3))
+				Expect(q.Reviews[2].ID).Should(Equal("3"))
+				Expect(q.Top).ShouldNot(BeNil())
+				Expect(q.Top.AccountID).Should(Equal(50948))
+				Expect(q.Missing).Should(BeNil())
+			})
+		})
+		Context("with embedded structs and inline fragments", func() {
+			type common struct {
+				Name string
+			}
+			var q struct {
+				Hero struct {
+					common
+					Droid struct {
+						PrimaryFunction string
+					} `graphql:"... on Droid"`
+				} `graphql:"hero"`
+			}
+			It("should decode them from the parent object", func() {
+				err := UnmarshalGraphQL([]byte(`{"hero": {"name": "R2-D2", "primaryFunction": "Astromech"}}`), &q)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(q.Hero.Name).Should(Equal("R2-D2"))
+				Expect(q.Hero.Droid.PrimaryFunction).Should(Equal("Astromech"))
+			})
+		})
+		Context("with a non-pointer value", func() {
+			It("should error", func() {
+				var q struct{ Name string }
+				err := UnmarshalGraphQL([]byte(`{"name": "x"}`), q)
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+		Context("with mismatched types", func() {
+			It("should error", func() {
+				var q struct{ Count int }
+				err := UnmarshalGraphQL([]byte(`{"count": "many"}`), &q)
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+})
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"net/url"
+)
+
+// APIKey is a user API key. The Key itself is only returned by Create, log in with it
+// using options.UserAPIKey.
+type APIKey struct {
+	ID       string `json:"_id"`
+	Key      string `json:"key,omitempty"`
+	Name     string `json:"name"`
+	Disabled bool   `json:"disabled"`
+}
+
+// APIKeys manages the API keys of the logged in user, authenticating with the refresh token.
+type APIKeys struct {
+	client *Client
+}
+
+// APIKeys returns the API key management API of the logged in user.
+func (c *Client) APIKeys() *APIKeys {
+	return &APIKeys{client: c}
+}
+
+// Create creates an enabled API key with the given name.
+func (a *APIKeys) Create(ctx context.Context, name string) (*APIKey, error) {
+	var key APIKey
+	err := a.do(ctx, "POST", "", map[string]interface{}{"name": name}, &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// List returns the API keys of the user.
+func (a *APIKeys) List(ctx context.Context) ([]APIKey, error) {
+	var keys []APIKey
+	err := a.do(ctx, "GET", "", nil, &keys)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Fetch returns the API key with the given id.
+func (a *APIKeys) Fetch(ctx context.Context, id string) (*APIKey, error) {
+	var key APIKey
+	err := a.do(ctx, "GET", "/"+url.PathEscape(id), nil, &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Enable allows logging in with the API key again.
+func (a *APIKeys) Enable(ctx context.Context, id string) error {
+	return a.do(ctx, "PUT", "/"+url.PathEscape(id)+"/enable", nil, nil)
+}
+
+// Disable prevents logging in with the API key, without deleting it.
+func (a *APIKeys) Disable(ctx context.Context, id string) error {
+	return a.do(ctx, "PUT", "/"+url.PathEscape(id)+"/disable", nil, nil)
+}
+
+// Delete deletes the API key.
+func (a *APIKeys) Delete(ctx context.Context, id string) error {
+	return a.do(ctx, "DELETE", "/"+url.PathEscape(id), nil, nil)
+}
+
+func (a *APIKeys) do(ctx context.Context, method, path string, in, out interface{}) error {
+	c := a.client
+	t := c.CurrentToken()
+	if t == nil || t.RefreshToken == "" {
+		return ErrNotConnected
+	}
+	return doJSON(ctx, c.httpClient(), method, c.clientAPIURL()+"/auth/api_keys"+path, t.RefreshToken, in, out)
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/oauth2"
+)
+
+var _ = Describe("APIKeys", func() {
+	var server *httptest.Server
+	var nc *Client
+	var requests []string
+	var authorization string
+	BeforeEach(func() {
+		requests = nil
+		keys := func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			authorization = r.Header.Get("Authorization")
+			switch r.Method + " " + r.URL.Path {
+			case "POST /api/client/v2.0/auth/api_keys":
+				var body map[string]string
+				json.NewDecoder(r.Body).Decode(&body)
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"_id":"5ec1","key":"secret-key","name":"` + body["name"] + `","disabled":false}`))
+			case "GET /api/client/v2.0/auth/api_keys":
+				w.Write([]byte(`[{"_id":"5ec1","name":"sensor-1","disabled":false},{"_id":"5ec2","name":"sensor-2","disabled":true}]`))
+			case "GET /api/client/v2.0/auth/api_keys/5ec1":
+				w.Write([]byte(`{"_id":"5ec1","name":"sensor-1","disabled":false}`))
+			case "GET /api/client/v2.0/auth/api_keys/missing":
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":"API key not found","error_code":"APIKeyNotFound"}`))
+			}
+		}
+		server = newRealmServer(realmHandlers{clientPath("/auth/api_keys"): keys, clientPath("/auth/api_keys/"): keys})
+		var err error
+		nc, err = NewClient(testOptions(server))
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	It("should require a session", func() {
+		_, err := nc.APIKeys().List(context.TODO())
+		Expect(err).Should(MatchError(ErrNotConnected))
+
+		// an http client alone is not a session.
+		nc.HTTPClient = server.Client()
+		_, err = nc.APIKeys().List(context.TODO())
+		Expect(err).Should(MatchError(ErrNotConnected))
+	})
+	Context("when connected", func() {
+		BeforeEach(func() {
+			Expect(nc.ConnectWithToken(&oauth2.Token{AccessToken: "access", RefreshToken: "refresh"})).Should(Succeed())
+		})
+		It("should be used while the token is refreshed", func() {
+			done := make(chan error)
+			go func() {
+				done <- nc.Refresh(context.TODO())
+			}()
+			_, err := nc.APIKeys().List(context.TODO())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(authorization).Should(Equal("Bearer refresh"))
+			Expect(<-done).Should(Succeed())
+		})
+		It("should manage the keys with the refresh token", func() {
+			ctx := context.TODO()
+			keys := nc.APIKeys()
+
+			key, err := keys.Create(ctx, "sensor-1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(*key).Should(Equal(APIKey{ID: "5ec1", Key: "secret-key", Name: "sensor-1"}))
+			Expect(authorization).Should(Equal("Bearer refresh"))
+
+			list, err := keys.List(ctx)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(list).Should(HaveLen(2))
+			Expect(list[1].Disabled).Should(BeTrue())
+
+			key, err = keys.Fetch(ctx, "5ec1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(key.Name).Should(Equal("sensor-1"))
+
+			Expect(keys.Disable(ctx, "5ec1")).Should(Succeed())
+			Expect(keys.Enable(ctx, "5ec1")).Should(Succeed())
+			Expect(keys.Delete(ctx, "5ec1")).Should(Succeed())
+
+			Expect(requests).Should(Equal([]string{
+				"POST /api/client/v2.0/auth/api_keys",
+				"GET /api/client/v2.0/auth/api_keys",
+				"GET /api/client/v2.0/auth/api_keys/5ec1",
+				"PUT /api/client/v2.0/auth/api_keys/5ec1/disable",
+				"PUT /api/client/v2.0/auth/api_keys/5ec1/enable",
+				"DELETE /api/client/v2.0/auth/api_keys/5ec1",
+			}))
+		})
+		It("should return Realm errors", func() {
+			_, err := nc.APIKeys().Fetch(context.TODO(), "missing")
+			var serr *ServiceError
+			Expect(errors.As(err, &serr)).Should(BeTrue())
+			Expect(serr.Code).Should(Equal("APIKeyNotFound"))
+		})
+	})
+})
@@ -1,28 +1,41 @@
 // Package auth handles the Realm GraphQL Server authentication.
 // This consists of providing valid credentials to obtain a token.
-// The token is refreshed every 30 minutes.
+// The access token is refreshed once it expires, as read from its exp claim (usually 30 minutes).
 package auth
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"time"
+	"sync"
 
 	"github.com/desteves/realm/pkg/options"
 	"golang.org/x/oauth2"
 )
 
+// ErrNotConnected is returned when the client has no session, either because Connect was never called or after Disconnect.
+var ErrNotConnected = errors.New("realm: client is not connected")
+
 // Client holds a http realm client
 type Client struct {
-	HTTPClient *http.Client
-	Token      *oauth2.Token // public so the application can use withExtra() to access device id or user_id
+	HTTPClient *http.Client  // sends the access token of the session, use SessionClient while the session may be replaced or disconnected
+	Token      *oauth2.Token // public so the application can use withExtra() to access device id or user_id, replaced on every refresh
+	Store      TokenStore    // when set, Connect resumes the stored session and the session is saved after login and refresh
+	Hooks      Hooks         // called on login, refresh and logout
 
 	//private
-	options *options.ClientOptions
-	oauth   *oauth2.Config
+	options  *options.ClientOptions
+	oauth    *oauth2.Config
+	mu       sync.Mutex // guards HTTPClient, Token and source, which the refresh of a request updates
+	reauth   sync.Mutex // serializes Reauthenticate
+	source   *tokenSource
+	location *Location
 }
 
 // NewClient creates a new Client with endpoints to Realm based on the provided
@@ -40,25 +53,43 @@ func (c *Client) configure(opts *options.ClientOptions) error {
 	if err := opts.Validate(); err != nil {
 		return err
 	}
-	c.createEndpoint(*opts.AppID, *opts.AuthMechanism)
+	if opts.Logger != nil {
+		for _, w := range opts.Deprecations() {
+			opts.Logger.Warn(w)
+		}
+	}
+	c.createEndpoint(c.endpointOptions())
 	return nil
 }
 
-func (c *Client) createEndpoint(appid, provider string) {
+func (c *Client) createEndpoint(opts *options.ClientOptions) {
 	c.oauth.Endpoint = oauth2.Endpoint{
-		AuthURL:  "https://stitch.mongodb.com/api/client/v2.0/app/" + appid + "/auth/providers/" + provider + "/login",
-		TokenURL: "https://stitch.mongodb.com/api/client/v2.0/auth/session",
+		AuthURL:  opts.AppURL() + "/auth/providers/" + opts.ProviderName() + "/login",
+		TokenURL: opts.ClientAPIURL() + "/auth/session",
 	}
 }
 
 // Ping assumes an http service named "ping" with an incoming_webhook calling a function named "test" which returns 200 has been created.
 func (c *Client) Ping() error {
-	// TODO - add checks for nil
-	uri := "https://webhooks.mongodb-stitch.com/api/client/v2.0/app/" + *c.options.AppID + "/service/ping/incoming_webhook/test"
-	resp, err := c.HTTPClient.Get(uri)
+	return c.PingContext(context.Background())
+}
+
+// PingContext is Ping with a context for the request.
+func (c *Client) PingContext(ctx context.Context) error {
+	hc := c.SessionClient()
+	if hc == nil {
+		return ErrNotConnected
+	}
+	uri := c.options.WebhookAppURL() + "/service/ping/incoming_webhook/test"
+	req, err := http.NewRequest("GET", uri, nil)
 	if err != nil {
 		return err
 	}
+	resp, err := hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("bad response status (%+v)", resp.StatusCode)
@@ -67,77 +98,392 @@ func (c *Client) Ping() error {
 	return nil
 }
 
-// ConnectWithToken connect to realm with an existing token, either user-provided or internally obtained. Then token needs to be valid for the client to work.
+// ConnectWithToken connect to realm with an existing token, either user-provided or internally obtained. The access token is
+// refreshed against Realm's session endpoint once it expires, so the token needs at least a valid refresh token for the client to work.
 func (c *Client) ConnectWithToken(t *oauth2.Token) error {
-	c.HTTPClient = oauth2.NewClient(oauth2.NoContext, c.oauth.TokenSource(oauth2.NoContext, t))
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, c.httpClient())
+	source := newTokenSource(ctx, c.oauth.Endpoint.TokenURL, t)
+	hook := c.Hooks.refreshed(t)
+	source.refreshed = func(t *oauth2.Token, err error) {
+		if err == nil {
+			c.mu.Lock()
+			current := c.source == source // not replaced or disconnected while refreshing
+			if current {
+				c.Token = t
+			}
+			c.mu.Unlock()
+			if current {
+				// a failed save only costs a refresh or a login when the session is resumed.
+				c.saveToken(t)
+			}
+		}
+		hook(t, err)
+	}
+	// a copy keeps the timeout, redirect policy and cookie jar of the provided client.
+	hc := *c.httpClient()
+	hc.Transport = &transport{base: hc.Transport, source: source}
+	c.mu.Lock()
+	c.Token = t
+	c.source = source
+	c.HTTPClient = &hc
+	c.mu.Unlock()
 	return nil
 }
 
-// Connect connects to realm and establishes http client with auto refresh Token
+// SessionClient returns the HTTPClient of the session, which sends the access token, or nil without a session.
+// Unlike reading the HTTPClient field, it is safe while another goroutine connects or disconnects the client.
+func (c *Client) SessionClient() *http.Client {
+	hc, _ := c.connection()
+	return hc
+}
+
+// connection returns the http client and the token source of the session, both nil without a session.
+func (c *Client) connection() (*http.Client, *tokenSource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.source == nil {
+		return nil, nil
+	}
+	return c.HTTPClient, c.source
+}
+
+// httpClient returns the client for requests made without the access token,
+// ClientOptions.HTTPClient when set.
+func (c *Client) httpClient() *http.Client {
+	if c.options.HTTPClient != nil {
+		return c.options.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Connect connects to realm and establishes http client with auto refresh Token.
+// When ClientOptions.DiscoverLocation is set, the app is located first, see Locate.
 func (c *Client) Connect() error {
-	err := c.retrieveFirstToken()
+	return c.ConnectContext(context.Background())
+}
+
+// ConnectContext is Connect with a context bounding the location lookup and the login.
+// With a Store, the stored session is resumed if its token is still valid or can be refreshed,
+// otherwise the client logs in with the credential and saves the new session.
+func (c *Client) ConnectContext(ctx context.Context) error {
+	if c.options.DiscoverLocation != nil && *c.options.DiscoverLocation {
+		_, err := c.Locate(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if c.Store != nil && c.resume(ctx) == nil {
+		return nil
+	}
+	return c.Login(ctx)
+}
+
+// Login logs in with the credential of the options, replacing the current session if any, and saves the new session
+// to the Store. Unlike Connect, it neither locates the app nor resumes a stored session.
+func (c *Client) Login(ctx context.Context) error {
+	err := c.retrieveFirstToken(ctx)
+	if err != nil {
+		return err
+	}
+	err = c.ConnectWithToken(c.Token)
 	if err != nil {
 		return err
 	}
-	return c.ConnectWithToken(c.Token)
+	return c.save()
+}
+
+// Refresh refreshes the access token even if it has not expired yet, e.g. after it was rejected.
+func (c *Client) Refresh(ctx context.Context) error {
+	source := c.session()
+	if source == nil {
+		return ErrNotConnected
+	}
+	_, err := source.token(ctx, true)
+	return err
 }
 
-// func (c *Client) Disconnect() error {
-// 	// TODO
-// 	// c.HTTPClient.
-// 	return fmt.Errorf("not yet implemented")
-// }
+// CurrentToken returns the token of the session as last refreshed, without refreshing it, or nil without a session.
+func (c *Client) CurrentToken() *oauth2.Token {
+	source := c.session()
+	if source == nil {
+		return nil
+	}
+	return source.current()
+}
+
+// session returns the token source of the current session, nil without a session.
+func (c *Client) session() *tokenSource {
+	_, source := c.connection()
+	return source
+}
+
+// TokenSource returns the token source of the session, which refreshes the access token with Realm's refresh
+// protocol and keeps the client Token in sync, e.g. for oauth2.NewClient. It returns nil without a session.
+func (c *Client) TokenSource() oauth2.TokenSource {
+	source := c.session()
+	if source == nil {
+		return nil
+	}
+	return source
+}
+
+// Reauthenticate replaces the session after its access token was rejected, e.g. by the GraphQL server: the access
+// token is refreshed and, with relogin, the client logs in again with its credential if the refresh fails.
+// When refreshed is set, the refresh of the rejected access token already failed with ErrRefreshRejected, e.g. in
+// the transport of the request, so it is not attempted again: the client logs in again right away, or returns
+// ErrRefreshRejected without relogin.
+// The new login is kept in the current session, so requests in flight on the HTTPClient pick it up.
+// Concurrent calls for the same rejected access token are served by a single refresh or login: a call finding
+// the access token already replaced returns right away.
+func (c *Client) Reauthenticate(ctx context.Context, rejected string, refreshed, relogin bool) error {
+	c.reauth.Lock()
+	defer c.reauth.Unlock()
+	t := c.CurrentToken()
+	if t == nil {
+		return ErrNotConnected
+	}
+	if t.AccessToken != rejected {
+		return nil
+	}
+	if refreshed {
+		if !relogin {
+			return ErrRefreshRejected
+		}
+		return c.relogin(ctx)
+	}
+	err := c.Refresh(ctx)
+	if err == nil || !relogin {
+		return err
+	}
+	return c.relogin(ctx)
+}
+
+// relogin logs in with the credential and keeps the new token in the current session.
+func (c *Client) relogin(ctx context.Context) error {
+	source := c.session()
+	if source == nil {
+		return ErrNotConnected
+	}
+	provider, cred := c.loginCredential()
+	t, err := c.login(ctx, c.httpClient(), c.oauth.Endpoint.AuthURL, provider, cred)
+	if err != nil {
+		return err
+	}
+	source.replace(t)
+	c.mu.Lock()
+	current := c.source == source // not disconnected while logging in
+	if current {
+		c.Token = t
+	}
+	c.mu.Unlock()
+	if !current {
+		return ErrNotConnected
+	}
+	c.Hooks.login(t)
+	return c.saveToken(t)
+}
+
+// resume connects with the stored token, refreshing it when it has expired.
+// A token which cannot be refreshed is deleted from the store.
+func (c *Client) resume(ctx context.Context) error {
+	key, err := c.storeKey()
+	if err != nil {
+		return err
+	}
+	t, err := c.Store.Load(key)
+	if err != nil {
+		return err
+	}
+	err = c.ConnectWithToken(t)
+	if err != nil {
+		return err
+	}
+	if t.Valid() {
+		return nil
+	}
+	source := c.session()
+	if source == nil {
+		return ErrNotConnected
+	}
+	_, err = source.tokenContext(ctx)
+	if err != nil {
+		c.mu.Lock()
+		if c.source == source { // not replaced meanwhile
+			c.Token = &oauth2.Token{}
+			c.source = nil
+			c.HTTPClient = nil
+		}
+		c.mu.Unlock()
+		c.Store.Delete(key)
+		return err
+	}
+	return c.save()
+}
+
+// save stores the current session, if the client has a Store.
+func (c *Client) save() error {
+	return c.saveToken(c.Token)
+}
+
+// saveToken stores the token of the session, if the client has a Store.
+func (c *Client) saveToken(t *oauth2.Token) error {
+	if c.Store == nil {
+		return nil
+	}
+	key, err := c.storeKey()
+	if err != nil {
+		return err
+	}
+	return c.Store.Save(key, t)
+}
+
+// storeKey identifies the session in the Store by app, provider and a fingerprint of the credential,
+// the SHA-256 of its login payload, so clients logging in as different users do not share a session.
+func (c *Client) storeKey() (string, error) {
+	provider, credential := c.loginCredential()
+	cred, err := credential.Resolve()
+	if err != nil {
+		return "", err
+	}
+	payload, err := loginPayload(provider, cred)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	prefix := *c.options.AppID + "/" + provider
+	sum := sha256.Sum256(append([]byte(prefix+"\n"), b...))
+	return prefix + "/" + hex.EncodeToString(sum[:]), nil
+}
+
+// Disconnect ends the session by revoking the refresh token with Realm. The Token is cleared and the
+// http client torn down even if the revocation fails, so subsequent calls return ErrNotConnected.
+// The session is also deleted from the Store, if any.
+func (c *Client) Disconnect(ctx context.Context) (err error) {
+	c.mu.Lock()
+	if c.HTTPClient == nil {
+		c.mu.Unlock()
+		return ErrNotConnected
+	}
+	t := c.Token
+	if c.source != nil {
+		t = c.source.current()
+	}
+	c.Token = &oauth2.Token{}
+	c.source = nil
+	c.HTTPClient = nil
+	c.mu.Unlock()
+	refreshToken := t.RefreshToken
+	c.Hooks.logout(t)
+	if c.Store != nil {
+		defer func() {
+			key, serr := c.storeKey()
+			if serr == nil {
+				serr = c.Store.Delete(key)
+			}
+			if err == nil {
+				err = serr
+			}
+		}()
+	}
+
+	req, err := http.NewRequest("DELETE", c.oauth.Endpoint.TokenURL, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+refreshToken)
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("bad response status (%+v)", resp.StatusCode)
+	}
+	return nil
+}
 
 // Because of non-standard body and headers we need to do a little "hack"
 // and request the first Token slightly different than how the
 // oauth2 package does it. Need to further explore if we can use the
 // native oauth2 functions instead...using this for *now*
-func (c *Client) retrieveFirstToken() error {
-
-	b, err := json.Marshal(c.options.Credential)
+func (c *Client) retrieveFirstToken(ctx context.Context) error {
+	provider, cred := c.loginCredential()
+	t, err := c.login(ctx, c.httpClient(), c.oauth.Endpoint.AuthURL, provider, cred)
 	if err != nil {
 		return err
 	}
+	c.Token = t
+	c.Hooks.login(t)
+	return nil
+}
+
+// loginCredential returns the provider and credential of the options to log in with.
+func (c *Client) loginCredential() (string, *options.Credential) {
+	provider := c.options.ProviderName()
+	if provider == "anon-user" {
+		// Validate ignores the credential of anonymous users, so does the login.
+		return provider, nil
+	}
+	return provider, c.options.Credential
+}
+
+// login posts the provider payload of the credential to the login url and returns the token of the response.
+// The http client hc adds the access token when linking, so the response is the one of the current user.
+func (c *Client) login(ctx context.Context, hc *http.Client, url, provider string, credential *options.Credential) (*oauth2.Token, error) {
+
+	// secret references are only resolved now, so they are read at every login.
+	cred, err := credential.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := loginPayload(provider, cred)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
 	body := bytes.NewReader(b)
-	req, err := http.NewRequest("POST", c.oauth.Endpoint.AuthURL, body)
+	req, err := http.NewRequest("POST", url, body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := hc.Do(req.WithContext(ctx))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad response %+v", resp)
+		return nil, newServiceError(resp)
 	}
 	b, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = json.Unmarshal(b, &c.Token)
+	t := &oauth2.Token{}
+	err = json.Unmarshal(b, t)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// one day this will be set properly in the response. The docs say 30 mins, so setting it to 29
-	// https://docs.mongodb.com/stitch/graphql/authenticate-graphql-requests/#refresh-a-client-api-access-token
-	if c.Token.Expiry.IsZero() {
-		c.Token.Expiry = time.Now().Add(time.Minute * 29)
-	}
+	setExpiry(t)
 
 	// also storing other "raw" but undocumented fields in the response.
 	raw := map[string]interface{}{}
 	err = json.Unmarshal(b, &raw)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	delete(raw, "access_token")
 	delete(raw, "refresh_token")
 	delete(raw, "token_type")
 	delete(raw, "expiry")
-	c.Token = c.Token.WithExtra(raw)
-	return nil
+	return t.WithExtra(raw), nil
 }
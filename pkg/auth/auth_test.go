@@ -1,13 +1,53 @@
 package auth
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus/hooks/test"
 	"golang.org/x/oauth2"
 
 	"github.com/desteves/realm/pkg/options"
 )
 
+// magicLinkProvider is an in-house provider logging in with a token sent by email.
+type magicLinkProvider struct{}
+
+func (magicLinkProvider) Name() string { return "magic-link" }
+
+func (magicLinkProvider) Validate(cred *options.Credential) error {
+	if cred == nil || cred.Token == nil {
+		return options.ErrMissingCredential
+	}
+	return nil
+}
+
+func (magicLinkProvider) LoginPayload(cred *options.Credential) (interface{}, error) {
+	return map[string]interface{}{"link": *cred.Token}, nil
+}
+
+// recordingTransport records the path of every request it sends.
+type recordingTransport struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (t *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.paths = append(t.paths, r.Method+" "+r.URL.Path)
+	t.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(r)
+}
+
 var _ = Describe("Auth", func() {
 	Describe("NewClient", func() {
 		Context("with Options", func() {
@@ -140,4 +180,617 @@ var _ = Describe("Auth", func() {
 
 		})
 	})
+	Describe("Disconnect", func() {
+		var opts options.ClientOptions
+		var server *httptest.Server
+		var nc *Client
+		var method, authorization string
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method = r.Method
+				authorization = r.Header.Get("Authorization")
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			appid := "graphqlserver-lrnqt"
+			auth := "anon-user"
+			opts.AppID = &appid
+			opts.AuthMechanism = &auth
+
+			var err error
+			nc, err = NewClient(&opts)
+			Expect(err).ShouldNot(HaveOccurred())
+			nc.oauth.Endpoint.TokenURL = server.URL
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		Context("when connected", func() {
+			BeforeEach(func() {
+				err := nc.ConnectWithToken(&oauth2.Token{AccessToken: "access", RefreshToken: "refresh"})
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+			It("should revoke the session with the refresh token", func() {
+				err := nc.Disconnect(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(method).Should(Equal("DELETE"))
+				Expect(authorization).Should(Equal("Bearer refresh"))
+			})
+			It("should clear the token and the http client", func() {
+				err := nc.Disconnect(context.TODO())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(nc.Token).Should(BeEquivalentTo(&oauth2.Token{}))
+				Expect(nc.HTTPClient).Should(BeNil())
+				Expect(nc.Ping()).Should(MatchError(ErrNotConnected))
+			})
+		})
+		Context("when not connected", func() {
+			It("should return ErrNotConnected", func() {
+				Expect(nc.Disconnect(context.TODO())).Should(MatchError(ErrNotConnected))
+			})
+		})
+	})
+	Describe("tokenSource", func() {
+		var server *httptest.Server
+		var refreshes int32
+		var method, authorization string
+		BeforeEach(func() {
+			atomic.StoreInt32(&refreshes, 0)
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&refreshes, 1)
+				method = r.Method
+				authorization = r.Header.Get("Authorization")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"access_token":"fresh"}`))
+			}))
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		Context("with an expired token", func() {
+			var ts *tokenSource
+			BeforeEach(func() {
+				t := &oauth2.Token{AccessToken: "stale", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)}
+				t = t.WithExtra(map[string]interface{}{"user_id": "5eb1", "device_id": "5eb2"})
+				ts = newTokenSource(context.TODO(), server.URL, t)
+			})
+			It("should refresh with the refresh token as bearer", func() {
+				t, err := ts.Token()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(method).Should(Equal("POST"))
+				Expect(authorization).Should(Equal("Bearer refresh"))
+				Expect(t.AccessToken).Should(Equal("fresh"))
+				Expect(t.Valid()).Should(BeTrue())
+			})
+			It("should keep the refresh token and the extra fields", func() {
+				t, err := ts.Token()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(t.RefreshToken).Should(Equal("refresh"))
+				Expect(t.Extra("user_id")).Should(Equal("5eb1"))
+				Expect(t.Extra("device_id")).Should(Equal("5eb2"))
+			})
+			It("should refresh only once when used concurrently", func() {
+				var wg sync.WaitGroup
+				for i := 0; i < 10; i++ {
+					wg.Add(1)
+					go func() {
+						defer GinkgoRecover()
+						defer wg.Done()
+						_, err := ts.Token()
+						Expect(err).ShouldNot(HaveOccurred())
+					}()
+				}
+				wg.Wait()
+				Expect(atomic.LoadInt32(&refreshes)).Should(BeEquivalentTo(1))
+			})
+		})
+		Context("with a valid token", func() {
+			It("should not refresh", func() {
+				ts := newTokenSource(context.TODO(), server.URL, &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)})
+				t, err := ts.Token()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(t.AccessToken).Should(Equal("access"))
+				Expect(atomic.LoadInt32(&refreshes)).Should(BeEquivalentTo(0))
+			})
+		})
+		Context("without a refresh token", func() {
+			It("should error", func() {
+				ts := newTokenSource(context.TODO(), server.URL, &oauth2.Token{AccessToken: "stale", Expiry: time.Now().Add(-time.Minute)})
+				_, err := ts.Token()
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+		Context("with a slow refresh", func() {
+			var slow *httptest.Server
+			var release chan struct{}
+			BeforeEach(func() {
+				release = make(chan struct{})
+				slow = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&refreshes, 1)
+					<-release
+					w.Write([]byte(`{"access_token":"fresh"}`))
+				}))
+			})
+			AfterEach(func() {
+				slow.Close()
+			})
+			It("should not block the readers of the token", func() {
+				ts := newTokenSource(context.TODO(), slow.URL, &oauth2.Token{AccessToken: "stale", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)})
+				refreshed := make(chan *oauth2.Token)
+				go func() {
+					t, _ := ts.Token()
+					refreshed <- t
+				}()
+				Eventually(func() int32 { return atomic.LoadInt32(&refreshes) }).Should(BeEquivalentTo(1))
+				Expect(ts.current().AccessToken).Should(Equal("stale"))
+				Expect(ts.lastUsed()).ShouldNot(BeZero())
+
+				// a caller joining the refresh gives up with its context.
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				defer cancel()
+				_, err := ts.tokenContext(ctx)
+				Expect(err).Should(Equal(context.DeadlineExceeded))
+
+				close(release)
+				Expect((<-refreshed).AccessToken).Should(Equal("fresh"))
+				Expect(atomic.LoadInt32(&refreshes)).Should(BeEquivalentTo(1))
+			})
+		})
+		Context("used by the client", func() {
+			It("should keep the client Token in sync", func() {
+				realm := newRealmServer(nil)
+				defer realm.Close()
+				appid := "graphqlserver-lrnqt"
+				auth := "anon-user"
+				nc, err := NewClient(&options.ClientOptions{AppID: &appid, AuthMechanism: &auth, BaseURL: &realm.URL, WebhookBaseURL: &realm.URL})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(nc.ConnectWithToken(&oauth2.Token{AccessToken: "stale", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)})).Should(Succeed())
+				Expect(nc.Ping()).Should(Succeed())
+				Expect(nc.Token.AccessToken).ShouldNot(Equal("stale"))
+				Expect(nc.Token.Valid()).Should(BeTrue())
+			})
+			It("should be usable with an oauth2 client", func() {
+				realm := newRealmServer(nil)
+				defer realm.Close()
+				nc, err := NewClient(testOptions(realm))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(nc.TokenSource()).Should(BeNil())
+				Expect(nc.ConnectWithToken(&oauth2.Token{AccessToken: "stale", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)})).Should(Succeed())
+
+				hc := oauth2.NewClient(context.WithValue(context.TODO(), oauth2.HTTPClient, realm.Client()), nc.TokenSource())
+				resp, err := hc.Get(realm.URL + appPath("/service/ping/incoming_webhook/test"))
+				Expect(err).ShouldNot(HaveOccurred())
+				resp.Body.Close()
+				Expect(resp.StatusCode).Should(Equal(http.StatusOK))
+				Expect(nc.Token.AccessToken).ShouldNot(Equal("stale"))
+			})
+		})
+	})
+	Describe("Claims", func() {
+		var exp time.Time
+		var token string
+		BeforeEach(func() {
+			exp = time.Now().Add(30 * time.Minute).Truncate(time.Second)
+			token = jwt(map[string]interface{}{
+				"sub":            "5eb1",
+				"typ":            "access",
+				"exp":            exp.Unix(),
+				"baas_device_id": "5eb2",
+				"user_data":      map[string]interface{}{"plan": "free"},
+			})
+		})
+		It("should decode the access token claims", func() {
+			claims, err := parseClaims(token)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(claims.Subject).Should(Equal("5eb1"))
+			Expect(claims.DeviceID).Should(Equal("5eb2"))
+			Expect(claims.UserData).Should(HaveKeyWithValue("plan", "free"))
+			Expect(claims.Expiry()).Should(BeTemporally("==", exp))
+		})
+		It("should set the token expiry from the exp claim", func() {
+			t := &oauth2.Token{AccessToken: token}
+			setExpiry(t)
+			Expect(t.Expiry).Should(BeTemporally("==", exp))
+		})
+		It("should fall back to 29 minutes for opaque tokens", func() {
+			t := &oauth2.Token{AccessToken: "opaque"}
+			setExpiry(t)
+			Expect(t.Expiry).Should(BeTemporally("~", time.Now().Add(29*time.Minute), time.Second))
+		})
+		It("should be available from a connected client", func() {
+			appid := "graphqlserver-lrnqt"
+			auth := "anon-user"
+			nc, err := NewClient(&options.ClientOptions{AppID: &appid, AuthMechanism: &auth})
+			Expect(err).ShouldNot(HaveOccurred())
+			_, err = nc.Claims()
+			Expect(err).Should(MatchError(ErrNotConnected))
+
+			err = nc.ConnectWithToken(&oauth2.Token{AccessToken: token, RefreshToken: "refresh"})
+			Expect(err).ShouldNot(HaveOccurred())
+			claims, err := nc.Claims()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(claims.Subject).Should(Equal("5eb1"))
+		})
+		It("should be read while the token is refreshed", func() {
+			realm := newRealmServer(nil)
+			defer realm.Close()
+			nc, err := NewClient(testOptions(realm))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(nc.ConnectWithToken(&oauth2.Token{AccessToken: token, RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)})).Should(Succeed())
+			done := make(chan error)
+			go func() {
+				done <- nc.Ping()
+			}()
+			claims, err := nc.Claims()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(claims.Subject).Should(Equal("5eb1"))
+			Expect(<-done).Should(Succeed())
+		})
+	})
+	Describe("BaseURL", func() {
+		var server *httptest.Server
+		var nc *Client
+		BeforeEach(func() {
+			server = newRealmServer(nil)
+			appid := "graphqlserver-lrnqt"
+			auth := "anon-user"
+			nc, _ = NewClient(&options.ClientOptions{AppID: &appid, AuthMechanism: &auth, BaseURL: &server.URL, WebhookBaseURL: &server.URL})
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("should derive every endpoint from it", func() {
+			Expect(nc.oauth.Endpoint.AuthURL).Should(Equal(server.URL + "/api/client/v2.0/app/graphqlserver-lrnqt/auth/providers/anon-user/login"))
+			Expect(nc.oauth.Endpoint.TokenURL).Should(Equal(server.URL + "/api/client/v2.0/auth/session"))
+		})
+		It("should connect, ping and disconnect", func() {
+			Expect(nc.Connect()).Should(Succeed())
+			Expect(nc.Token.Extra("user_id")).Should(Equal("5eb1"))
+			Expect(nc.Ping()).Should(Succeed())
+			Expect(nc.Disconnect(context.TODO())).Should(Succeed())
+		})
+	})
+	Describe("Locate", func() {
+		var global, regional *httptest.Server
+		var opts options.ClientOptions
+		var lookups int32
+		BeforeEach(func() {
+			atomic.StoreInt32(&lookups, 0)
+			regional = newRealmServer(nil)
+			global = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/client/v2.0/app/graphqlserver-lrnqt/location" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				atomic.AddInt32(&lookups, 1)
+				w.Write([]byte(`{"deployment_model":"LOCAL","location":"US-VA","hostname":"` + regional.URL + `","ws_hostname":"wss://us-east-1.aws.stitch.mongodb.com"}`))
+			}))
+			appid := "graphqlserver-lrnqt"
+			auth := "anon-user"
+			opts = options.ClientOptions{AppID: &appid, AuthMechanism: &auth, BaseURL: &global.URL}
+		})
+		AfterEach(func() {
+			global.Close()
+			regional.Close()
+		})
+		It("should cache the location and use its hostname", func() {
+			nc, err := NewClient(&opts)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(nc.Location()).Should(BeNil())
+
+			location, err := nc.Locate(context.TODO())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(location.DeploymentModel).Should(Equal("LOCAL"))
+			Expect(nc.Location()).Should(Equal(location))
+			Expect(nc.AppURL()).Should(Equal(regional.URL + "/api/client/v2.0/app/graphqlserver-lrnqt"))
+			Expect(nc.oauth.Endpoint.TokenURL).Should(Equal(regional.URL + "/api/client/v2.0/auth/session"))
+
+			_, err = nc.Locate(context.TODO())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(atomic.LoadInt32(&lookups)).Should(BeEquivalentTo(1))
+		})
+		It("should be used by Connect when DiscoverLocation is set", func() {
+			discover := true
+			opts.DiscoverLocation = &discover
+			nc, err := NewClient(&opts)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(nc.Connect()).Should(Succeed())
+			Expect(nc.Location()).ShouldNot(BeNil())
+			Expect(nc.Token.RefreshToken).Should(Equal("refresh"))
+		})
+		It("should not be used by Connect otherwise", func() {
+			nc, err := NewClient(&opts)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(nc.Connect()).ShouldNot(Succeed())
+			Expect(atomic.LoadInt32(&lookups)).Should(BeEquivalentTo(0))
+		})
+	})
+	Describe("HTTPClient", func() {
+		var server *httptest.Server
+		var transport *recordingTransport
+		var nc *Client
+		BeforeEach(func() {
+			server = newRealmServer(nil)
+			transport = &recordingTransport{}
+			appid := "graphqlserver-lrnqt"
+			auth := "anon-user"
+			discover := true
+			var err error
+			nc, err = NewClient(&options.ClientOptions{
+				AppID:            &appid,
+				AuthMechanism:    &auth,
+				BaseURL:          &server.URL,
+				WebhookBaseURL:   &server.URL,
+				DiscoverLocation: &discover,
+				HTTPClient:       &http.Client{Transport: transport, Timeout: 5 * time.Second},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			nc.location = &Location{Hostname: server.URL} // skip the lookup, the stub has no location endpoint
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("should carry all the Realm traffic", func() {
+			Expect(nc.Connect()).Should(Succeed())
+			Expect(nc.HTTPClient.Timeout).Should(Equal(5 * time.Second))
+
+			nc.source.t.Expiry = time.Now().Add(-time.Minute)
+			Expect(nc.Ping()).Should(Succeed())
+			Expect(nc.Disconnect(context.TODO())).Should(Succeed())
+
+			Expect(transport.paths).Should(Equal([]string{
+				"POST /api/client/v2.0/app/graphqlserver-lrnqt/auth/providers/anon-user/login",
+				"POST /api/client/v2.0/auth/session",
+				"GET /api/client/v2.0/app/graphqlserver-lrnqt/service/ping/incoming_webhook/test",
+				"DELETE /api/client/v2.0/auth/session",
+			}))
+		})
+	})
+	Describe("ConnectContext", func() {
+		var server *httptest.Server
+		var opts options.ClientOptions
+		var release chan struct{}
+		BeforeEach(func() {
+			release = make(chan struct{})
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-release // hang until the spec is over
+			}))
+			appid := "graphqlserver-lrnqt"
+			auth := "anon-user"
+			opts = options.ClientOptions{AppID: &appid, AuthMechanism: &auth, BaseURL: &server.URL, WebhookBaseURL: &server.URL}
+		})
+		AfterEach(func() {
+			close(release)
+			server.Close()
+		})
+		It("should give up the login when the context is done", func() {
+			nc, err := NewClient(&opts)
+			Expect(err).ShouldNot(HaveOccurred())
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err = nc.ConnectContext(ctx)
+			Expect(err).Should(HaveOccurred())
+			Expect(ctx.Err()).Should(Equal(context.DeadlineExceeded))
+		})
+		It("should bound the token refresh with the request context", func() {
+			nc, err := NewClient(&opts)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = nc.ConnectWithToken(&oauth2.Token{AccessToken: "stale", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)})
+			Expect(err).ShouldNot(HaveOccurred())
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err = nc.PingContext(ctx)
+			Expect(err).Should(HaveOccurred())
+			Expect(ctx.Err()).Should(Equal(context.DeadlineExceeded))
+		})
+	})
+	Describe("login", func() {
+		var server *httptest.Server
+		var body map[string]interface{}
+		BeforeEach(func() {
+			os.Setenv("TEST_REALM_PASSWORD", "hunter2")
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body = nil
+				json.NewDecoder(r.Body).Decode(&body)
+				w.Write([]byte(`{"access_token":"access","refresh_token":"refresh","user_id":"5eb1"}`))
+			}))
+		})
+		AfterEach(func() {
+			os.Unsetenv("TEST_REALM_PASSWORD")
+			server.Close()
+		})
+		It("should post the resolved secrets", func() {
+			appid := "graphqlserver-lrnqt"
+			auth := "local-userpass"
+			username := "diana"
+			password := "env:TEST_REALM_PASSWORD"
+			nc, err := NewClient(&options.ClientOptions{AppID: &appid, AuthMechanism: &auth, BaseURL: &server.URL,
+				Credential: &options.Credential{Username: &username, Password: &password}})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(nc.Connect()).Should(Succeed())
+			Expect(body).Should(Equal(map[string]interface{}{"username": "diana", "password": "hunter2"}))
+		})
+	})
+	Describe("Provider", func() {
+		str := func(s string) *string { return &s }
+		It("should build the wire format of each built-in", func() {
+			for _, c := range []struct {
+				provider string
+				cred     *options.Credential
+				payload  map[string]interface{}
+			}{
+				{"anon-user", nil, map[string]interface{}{}},
+				{"local-userpass", &options.Credential{Username: str("diana"), Password: str("secret")}, map[string]interface{}{"username": "diana", "password": "secret"}},
+				{"api-key", &options.Credential{Key: str("k")}, map[string]interface{}{"key": "k"}},
+				{"custom-token", &options.Credential{Token: str("jwt")}, map[string]interface{}{"token": "jwt"}},
+				{"oauth2-google", &options.Credential{Key: str("code")}, map[string]interface{}{"authCode": "code"}},
+				{"oauth2-google", &options.Credential{Token: str("id")}, map[string]interface{}{"id_token": "id"}},
+				{"oauth2-apple", &options.Credential{Token: str("id")}, map[string]interface{}{"id_token": "id"}},
+				{"oauth2-facebook", &options.Credential{Token: str("fb")}, map[string]interface{}{"accessToken": "fb"}},
+			} {
+				payload, err := loginPayload(c.provider, c.cred)
+				Expect(err).ShouldNot(HaveOccurred(), c.provider)
+				Expect(payload).Should(Equal(c.payload), c.provider)
+			}
+		})
+		It("should post custom-function payloads verbatim", func() {
+			type device struct {
+				Serial string `json:"serial"`
+				Pin    int    `json:"pin"`
+			}
+			payload, err := loginPayload("custom-function", options.FunctionCredential(device{Serial: "A42", Pin: 1234}))
+			Expect(err).ShouldNot(HaveOccurred())
+			b, err := json.Marshal(payload)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(b).Should(MatchJSON(`{"serial": "A42", "pin": 1234}`))
+		})
+		It("should log in with api-key for the deprecated key provider", func() {
+			appid := "graphqlserver-lrnqt"
+			auth := "key"
+			logger, logs := test.NewNullLogger()
+			opts := &options.ClientOptions{AppID: &appid, AuthMechanism: &auth, Credential: options.ServerAPIKey("k"), Logger: logger}
+			nc, err := NewClient(opts)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(nc.oauth.Endpoint.AuthURL).Should(HaveSuffix("/auth/providers/api-key/login"))
+			Expect(*opts.AuthMechanism).Should(Equal("key"))
+			Expect(logs.LastEntry().Message).Should(ContainSubstring(`"key" provider is deprecated`))
+		})
+		It("should refuse credentials of the wrong shape", func() {
+			_, err := loginPayload("oauth2-apple", &options.Credential{Key: str("k")})
+			Expect(errors.Is(err, options.ErrMissingCredential)).Should(BeTrue())
+			_, err = loginPayload("magic-wand", nil)
+			Expect(errors.Is(err, options.ErrUnsupportedProvider)).Should(BeTrue())
+		})
+		It("should share the registry of the options package", func() {
+			options.RegisterProvider(magicLinkProvider{})
+			defer UnregisterProvider("magic-link")
+			payload, err := loginPayload("magic-link", &options.Credential{Token: str("abc")})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(payload).Should(Equal(map[string]interface{}{"link": "abc"}))
+
+			UnregisterProvider("magic-link")
+			_, ok := options.LookupProvider("magic-link")
+			Expect(ok).Should(BeFalse())
+		})
+		Context("registered by the application", func() {
+			var server *httptest.Server
+			var path string
+			var body map[string]interface{}
+			BeforeEach(func() {
+				RegisterProvider(magicLinkProvider{})
+				server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					path = r.URL.Path
+					json.NewDecoder(r.Body).Decode(&body)
+					w.Write([]byte(`{"access_token":"access","refresh_token":"refresh","user_id":"5eb1"}`))
+				}))
+			})
+			AfterEach(func() {
+				server.Close()
+				UnregisterProvider("magic-link")
+			})
+			It("should be validated and used to log in", func() {
+				appid := "graphqlserver-lrnqt"
+				auth := "magic-link"
+				_, err := NewClient(&options.ClientOptions{AppID: &appid, AuthMechanism: &auth, BaseURL: &server.URL})
+				Expect(errors.Is(err, options.ErrMissingCredential)).Should(BeTrue())
+
+				nc, err := NewClient(&options.ClientOptions{AppID: &appid, AuthMechanism: &auth, BaseURL: &server.URL, Credential: &options.Credential{Token: str("abc")}})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(nc.Connect()).Should(Succeed())
+				Expect(path).Should(Equal("/api/client/v2.0/app/graphqlserver-lrnqt/auth/providers/magic-link/login"))
+				Expect(body).Should(Equal(map[string]interface{}{"link": "abc"}))
+
+				p, ok := LookupProvider("magic-link")
+				Expect(ok).Should(BeTrue())
+				Expect(p.Name()).Should(Equal("magic-link"))
+			})
+		})
+	})
+	Describe("Login", func() {
+		It("should return typed errors", func() {
+			server := newRealmServer(realmHandlers{
+				appPath("/auth/providers/local-userpass/login"): func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusUnauthorized)
+					w.Write([]byte(`{"error":"invalid username/password","error_code":"InvalidPassword","link":"https://realm.mongodb.com/groups/1/apps/2/logs?co_id=3"}`))
+				},
+			})
+			defer server.Close()
+			opts := testOptions(server)
+			provider, username, password := "local-userpass", "diana@example.com", "wrong"
+			opts.AuthMechanism = &provider
+			opts.Credential = &options.Credential{Username: &username, Password: &password}
+			nc, err := NewClient(opts)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = nc.Login(context.TODO())
+			Expect(errors.Is(err, ErrInvalidPassword)).Should(BeTrue())
+			var serr *ServiceError
+			Expect(errors.As(err, &serr)).Should(BeTrue())
+			Expect(serr.StatusCode).Should(Equal(http.StatusUnauthorized))
+			Expect(serr.Error()).ShouldNot(ContainSubstring("wrong"))
+			Expect(nc.HTTPClient).Should(BeNil())
+		})
+	})
+	Describe("EmailPassword", func() {
+		var server *httptest.Server
+		var ep *EmailPassword
+		var path string
+		var body map[string]interface{}
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				body = nil
+				json.NewDecoder(r.Body).Decode(&body)
+				switch {
+				case body["email"] == "taken@example.com":
+					w.WriteHeader(http.StatusConflict)
+					w.Write([]byte(`{"error":"name already in use","error_code":"AccountNameInUse","link":"https://realm.mongodb.com/groups/1/apps/2/logs?co_id=3"}`))
+				case body["token"] == "expired":
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(`{"error":"invalid token data","error_code":"UserpassTokenInvalid"}`))
+				default:
+					w.WriteHeader(http.StatusCreated)
+				}
+			}))
+			appid := "graphqlserver-lrnqt"
+			auth := "anon-user"
+			nc, err := NewClient(&options.ClientOptions{AppID: &appid, AuthMechanism: &auth, BaseURL: &server.URL})
+			Expect(err).ShouldNot(HaveOccurred())
+			ep = nc.EmailPassword()
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("should call the local-userpass endpoints", func() {
+			ctx := context.TODO()
+			prefix := "/api/client/v2.0/app/graphqlserver-lrnqt/auth/providers/local-userpass/"
+			for _, c := range []struct {
+				call func() error
+				path string
+				body map[string]interface{}
+			}{
+				{func() error { return ep.RegisterUser(ctx, "diana@example.com", "secret") }, "register", map[string]interface{}{"email": "diana@example.com", "password": "secret"}},
+				{func() error { return ep.ConfirmUser(ctx, "t", "tid") }, "confirm", map[string]interface{}{"token": "t", "tokenId": "tid"}},
+				{func() error { return ep.ResendConfirmationEmail(ctx, "diana@example.com") }, "confirm/send", map[string]interface{}{"email": "diana@example.com"}},
+				{func() error { return ep.SendResetPasswordEmail(ctx, "diana@example.com") }, "reset/send", map[string]interface{}{"email": "diana@example.com"}},
+				{func() error { return ep.ResetPassword(ctx, "t", "tid", "new") }, "reset", map[string]interface{}{"token": "t", "tokenId": "tid", "password": "new"}},
+				{func() error { return ep.CallResetPasswordFunction(ctx, "diana@example.com", "new", "sms") }, "reset/call", map[string]interface{}{"email": "diana@example.com", "password": "new", "arguments": []interface{}{"sms"}}},
+			} {
+				Expect(c.call()).Should(Succeed(), c.path)
+				Expect(path).Should(Equal(prefix+c.path), c.path)
+				Expect(body).Should(Equal(c.body), c.path)
+			}
+		})
+		It("should return typed errors", func() {
+			err := ep.RegisterUser(context.TODO(), "taken@example.com", "secret")
+			Expect(errors.Is(err, ErrUserAlreadyExists)).Should(BeTrue())
+			var serr *ServiceError
+			Expect(errors.As(err, &serr)).Should(BeTrue())
+			Expect(serr.StatusCode).Should(Equal(http.StatusConflict))
+			Expect(serr.Link).ShouldNot(BeEmpty())
+
+			err = ep.ConfirmUser(context.TODO(), "expired", "tid")
+			Expect(errors.Is(err, ErrInvalidToken)).Should(BeTrue())
+			Expect(errors.Is(err, ErrUserAlreadyExists)).Should(BeFalse())
+		})
+	})
 })
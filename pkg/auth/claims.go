@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Claims are the decoded claims of a Realm access token. The signature is not verified,
+// the token is only inspected to learn about the session.
+type Claims struct {
+	Subject   string                 `json:"sub"` // the user id
+	Type      string                 `json:"typ"`
+	ExpiresAt int64                  `json:"exp"`
+	IssuedAt  int64                  `json:"iat"`
+	DeviceID  string                 `json:"baas_device_id"`
+	DomainID  string                 `json:"baas_domain_id"`
+	UserData  map[string]interface{} `json:"user_data,omitempty"` // the custom user data, if enabled for the app
+}
+
+// Expiry returns the expiration time of the token, or the zero time if the claim is missing.
+func (c *Claims) Expiry() time.Time {
+	if c.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// Claims decodes the claims of the current access token.
+func (c *Client) Claims() (*Claims, error) {
+	t := c.CurrentToken()
+	if t == nil {
+		c.mu.Lock()
+		t = c.Token
+		c.mu.Unlock()
+	}
+	if t == nil || t.AccessToken == "" {
+		return nil, ErrNotConnected
+	}
+	return parseClaims(t.AccessToken)
+}
+
+// parseClaims decodes the payload of a JWT without verifying its signature.
+func parseClaims(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("access token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode the access token payload: %v", err)
+	}
+	var claims Claims
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode the access token claims: %v", err)
+	}
+	return &claims, nil
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+)
+
+// EmailPassword manages the users of the local-userpass provider: registration, confirmation and
+// password reset. None of its calls need a session. Realm errors are returned as *ServiceError,
+// matching ErrUserAlreadyExists, ErrInvalidToken, ErrUserNotFound... with errors.Is.
+type EmailPassword struct {
+	client *Client
+}
+
+// EmailPassword returns the local-userpass user management API of the app.
+func (c *Client) EmailPassword() *EmailPassword {
+	return &EmailPassword{client: c}
+}
+
+// RegisterUser creates a user, which may need to be confirmed before logging in depending on the app settings.
+func (e *EmailPassword) RegisterUser(ctx context.Context, email, password string) error {
+	return e.post(ctx, "register", map[string]interface{}{"email": email, "password": password})
+}
+
+// ConfirmUser confirms a user with the token and token id sent in the confirmation email.
+func (e *EmailPassword) ConfirmUser(ctx context.Context, token, tokenID string) error {
+	return e.post(ctx, "confirm", map[string]interface{}{"token": token, "tokenId": tokenID})
+}
+
+// ResendConfirmationEmail sends the confirmation email again.
+func (e *EmailPassword) ResendConfirmationEmail(ctx context.Context, email string) error {
+	return e.post(ctx, "confirm/send", map[string]interface{}{"email": email})
+}
+
+// SendResetPasswordEmail sends the password reset email.
+func (e *EmailPassword) SendResetPasswordEmail(ctx context.Context, email string) error {
+	return e.post(ctx, "reset/send", map[string]interface{}{"email": email})
+}
+
+// ResetPassword sets a new password with the token and token id sent in the password reset email.
+func (e *EmailPassword) ResetPassword(ctx context.Context, token, tokenID, password string) error {
+	return e.post(ctx, "reset", map[string]interface{}{"token": token, "tokenId": tokenID, "password": password})
+}
+
+// CallResetPasswordFunction resets the password through the reset function configured for the app,
+// which receives args after the email and password.
+func (e *EmailPassword) CallResetPasswordFunction(ctx context.Context, email, password string, args ...interface{}) error {
+	if args == nil {
+		args = []interface{}{}
+	}
+	return e.post(ctx, "reset/call", map[string]interface{}{"email": email, "password": password, "arguments": args})
+}
+
+func (e *EmailPassword) post(ctx context.Context, path string, body interface{}) error {
+	url := e.client.AppURL() + "/auth/providers/local-userpass/" + path
+	return doJSON(ctx, e.client.httpClient(), "POST", url, "", body, nil)
+}
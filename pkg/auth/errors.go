@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Sentinel errors matched by *ServiceError, usable with errors.Is.
+var (
+	ErrUserAlreadyExists    = errors.New("realm: user already exists")
+	ErrUserAlreadyConfirmed = errors.New("realm: user already confirmed")
+	ErrUserNotFound         = errors.New("realm: user not found")
+	ErrInvalidToken         = errors.New("realm: invalid token")
+	ErrInvalidPassword      = errors.New("realm: invalid password")
+	ErrInvalidSession       = errors.New("realm: invalid session")
+)
+
+// serviceErrors maps the error codes of the Realm client API to the sentinel errors.
+var serviceErrors = map[string]error{
+	"AccountNameInUse":     ErrUserAlreadyExists,
+	"UserAlreadyConfirmed": ErrUserAlreadyConfirmed,
+	"UserNotFound":         ErrUserNotFound,
+	"UserpassTokenInvalid": ErrInvalidToken,
+	"InvalidPassword":      ErrInvalidPassword,
+	"InvalidSession":       ErrInvalidSession,
+}
+
+// ServiceError is an error response of the Realm client API, e.g.
+// {"error": "name already in use", "error_code": "AccountNameInUse", "link": "..."}
+type ServiceError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"error_code"`
+	Message    string `json:"error"`
+	Link       string `json:"link,omitempty"` // to the app logs
+}
+
+// Error implements the error interface.
+func (e *ServiceError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("realm: bad response status (%+v) %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("realm: %s (%s, status %d)", e.Message, e.Code, e.StatusCode)
+}
+
+// Is reports whether the error code corresponds to target, one of the Err* sentinels.
+func (e *ServiceError) Is(target error) bool {
+	sentinel, ok := serviceErrors[e.Code]
+	return ok && sentinel == target
+}
+
+// newServiceError reads the error response of the Realm client API.
+func newServiceError(resp *http.Response) *ServiceError {
+	serr := &ServiceError{StatusCode: resp.StatusCode}
+	b, _ := ioutil.ReadAll(resp.Body)
+	if json.Unmarshal(b, serr) != nil {
+		serr.Message = string(b)
+	}
+	return serr
+}
+
+// ErrRefreshRejected is matched by the *RefreshError of a refresh Realm answered 401 Unauthorized, e.g. because
+// the refresh token was revoked or has expired. Requests sent with the HTTPClient of the session fail with it,
+// wrapped in a *url.Error, until the client logs in again.
+var ErrRefreshRejected = errors.New("realm: refresh token rejected")
+
+// RefreshError is returned when Realm did not refresh the access token.
+type RefreshError struct {
+	Err *ServiceError // the error response of the session endpoint
+}
+
+// Error implements the error interface.
+func (e *RefreshError) Error() string {
+	return "realm: cannot refresh the access token: " + e.Err.Error()
+}
+
+// Is reports whether target is ErrRefreshRejected and Realm answered 401 Unauthorized.
+func (e *RefreshError) Is(target error) bool {
+	return target == ErrRefreshRejected && e.Err.StatusCode == http.StatusUnauthorized
+}
+
+// Unwrap returns the error response.
+func (e *RefreshError) Unwrap() error {
+	return e.Err
+}
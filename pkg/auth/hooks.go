@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"golang.org/x/oauth2"
+)
+
+// Hooks are called on the session events of a Client, e.g. to persist tokens, emit metrics or ask the user to log in again.
+// Any of them may be nil. They are called synchronously by the goroutine causing the event, so they should return quickly.
+// The user id is empty if it cannot be read from the token.
+// They are set on a Client, on Sessions for the clients of its logins, or on the Auth client of a graphql.Client,
+// which also reports the logins and refreshes of its re-authentication.
+type Hooks struct {
+	// OnLogin is called once the client logged in with its credential, or linked a credential.
+	OnLogin func(t *oauth2.Token, userID string)
+	// OnRefresh is called with the new access token once it has been refreshed.
+	OnRefresh func(t *oauth2.Token, userID string)
+	// OnRefreshError is called when the access token cannot be refreshed, e.g. because the refresh token was revoked.
+	OnRefreshError func(err error, userID string)
+	// OnLogout is called by Disconnect with the token of the session which ended.
+	OnLogout func(t *oauth2.Token, userID string)
+}
+
+func (h *Hooks) login(t *oauth2.Token) {
+	if h.OnLogin != nil {
+		h.OnLogin(t, hookUserID(t))
+	}
+}
+
+func (h *Hooks) logout(t *oauth2.Token) {
+	if h.OnLogout != nil {
+		h.OnLogout(t, hookUserID(t))
+	}
+}
+
+// refreshed returns the callback of the token source, which also needs the previous token for the user id of a failure.
+func (h *Hooks) refreshed(previous *oauth2.Token) func(*oauth2.Token, error) {
+	return func(t *oauth2.Token, err error) {
+		if err != nil {
+			if h.OnRefreshError != nil {
+				h.OnRefreshError(err, hookUserID(previous))
+			}
+			return
+		}
+		if h.OnRefresh != nil {
+			h.OnRefresh(t, hookUserID(t))
+		}
+	}
+}
+
+func hookUserID(t *oauth2.Token) string {
+	id, _ := userID(t)
+	return id
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/oauth2"
+)
+
+var _ = Describe("Hooks", func() {
+	var server *httptest.Server
+	var nc *Client
+	var events []string
+	BeforeEach(func() {
+		events = nil
+		server = newRealmServer(nil)
+		var err error
+		nc, err = NewClient(testOptions(server))
+		Expect(err).ShouldNot(HaveOccurred())
+		nc.Hooks = Hooks{
+			OnLogin: func(t *oauth2.Token, userID string) {
+				Expect(t.RefreshToken).Should(Equal("refresh"))
+				events = append(events, "login "+userID)
+			},
+			OnRefresh: func(t *oauth2.Token, userID string) {
+				Expect(t.Valid()).Should(BeTrue())
+				events = append(events, "refresh "+userID)
+			},
+			OnRefreshError: func(err error, userID string) {
+				Expect(err).Should(HaveOccurred())
+				events = append(events, "refresh error "+userID)
+			},
+			OnLogout: func(t *oauth2.Token, userID string) {
+				Expect(t.RefreshToken).Should(Equal("refresh"))
+				events = append(events, "logout "+userID)
+			},
+		}
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	It("should be called on login and logout", func() {
+		Expect(nc.Connect()).Should(Succeed())
+		Expect(nc.Ping()).Should(Succeed())
+		Expect(nc.Disconnect(context.TODO())).Should(Succeed())
+		Expect(events).Should(Equal([]string{"login 5eb1", "logout 5eb1"}))
+	})
+	It("should be called on refresh", func() {
+		Expect(nc.ConnectWithToken((&oauth2.Token{AccessToken: "stale", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)}).
+			WithExtra(map[string]interface{}{"user_id": "5eb1"}))).Should(Succeed())
+		Expect(nc.Ping()).Should(Succeed())
+		Expect(nc.Ping()).Should(Succeed())
+		Expect(events).Should(Equal([]string{"refresh 5eb1"}))
+	})
+	It("should be called when the refresh fails", func() {
+		Expect(nc.ConnectWithToken((&oauth2.Token{AccessToken: "stale", Expiry: time.Now().Add(-time.Minute)}).
+			WithExtra(map[string]interface{}{"user_id": "5eb1"}))).Should(Succeed())
+		Expect(nc.Ping()).ShouldNot(Succeed())
+		Expect(events).Should(Equal([]string{"refresh error 5eb1"}))
+	})
+})
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/desteves/realm/pkg/options"
+)
+
+// LinkCredential links the identity of the credential for the provider to the logged in user, e.g. to keep the
+// data of an anon-user once they sign up with local-userpass. The Token is replaced by the one issued for the
+// link and the identities of the user, including the new one, are returned.
+func (c *Client) LinkCredential(ctx context.Context, provider string, credential *options.Credential) ([]Identity, error) {
+	hc, source := c.connection()
+	if source == nil {
+		return nil, ErrNotConnected
+	}
+	if p, ok := LookupProvider(provider); ok {
+		if err := p.Validate(credential); err != nil {
+			return nil, err
+		}
+	}
+	url := c.AppURL() + "/auth/providers/" + provider + "/login?link=true"
+	t, err := c.login(ctx, hc, url, provider, credential)
+	if err != nil {
+		return nil, err
+	}
+
+	// the link response only carries a new access token, the session and its extra fields stay the same.
+	current := source.current()
+	if t.RefreshToken == "" {
+		t.RefreshToken = current.RefreshToken
+	}
+	extra := map[string]interface{}{}
+	for _, key := range tokenExtras {
+		if v := t.Extra(key); v != nil {
+			extra[key] = v
+		} else if v := current.Extra(key); v != nil {
+			extra[key] = v
+		}
+	}
+	err = c.ConnectWithToken(t.WithExtra(extra))
+	if err != nil {
+		return nil, err
+	}
+	c.Hooks.login(c.Token)
+	err = c.save()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := c.Profile(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return user.Identities, nil
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/desteves/realm/pkg/options"
+)
+
+var _ = Describe("LinkCredential", func() {
+	var server *httptest.Server
+	var nc *Client
+	var linked map[string]interface{}
+	var authorization string
+	BeforeEach(func() {
+		linked = nil
+		server = newRealmServer(realmHandlers{
+			appPath("/auth/providers/local-userpass/login"): func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("link") != "true" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				authorization = r.Header.Get("Authorization")
+				var body map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&body)
+				if body["username"] == "taken@example.com" {
+					w.WriteHeader(http.StatusConflict)
+					w.Write([]byte(`{"error":"name already in use","error_code":"AccountNameInUse"}`))
+					return
+				}
+				linked = body
+				w.Write([]byte(`{"access_token":"` + accessToken("5eb1") + `","user_id":"5eb1"}`))
+			},
+			clientPath("/auth/profile"): func(w http.ResponseWriter, r *http.Request) {
+				identities := `{"id":"5eb3","provider_type":"anon-user","provider_id":"5ea4"}`
+				if linked != nil {
+					identities += `,{"id":"diana@example.com","provider_type":"local-userpass","provider_id":"5ea5"}`
+				}
+				w.Write([]byte(`{"user_id":"5eb1","identities":[` + identities + `]}`))
+			},
+		})
+		var err error
+		nc, err = NewClient(testOptions(server))
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	It("should require a session", func() {
+		_, err := nc.LinkCredential(context.TODO(), "local-userpass", &options.Credential{})
+		Expect(err).Should(MatchError(ErrNotConnected))
+
+		// an http client alone is not a session.
+		nc.HTTPClient = server.Client()
+		_, err = nc.LinkCredential(context.TODO(), "local-userpass", &options.Credential{})
+		Expect(err).Should(MatchError(ErrNotConnected))
+	})
+	It("should validate the credential for the provider", func() {
+		Expect(nc.Connect()).Should(Succeed())
+		_, err := nc.LinkCredential(context.TODO(), "local-userpass", &options.Credential{})
+		Expect(errors.Is(err, options.ErrMissingCredential)).Should(BeTrue())
+		Expect(linked).Should(BeNil())
+	})
+	It("should return typed errors", func() {
+		Expect(nc.Connect()).Should(Succeed())
+		username, password := "taken@example.com", "secret"
+		_, err := nc.LinkCredential(context.TODO(), "local-userpass", &options.Credential{Username: &username, Password: &password})
+		Expect(errors.Is(err, ErrUserAlreadyExists)).Should(BeTrue())
+		Expect(linked).Should(BeNil())
+	})
+	It("should link the identity to the current user", func() {
+		Expect(nc.Connect()).Should(Succeed())
+		access := nc.Token.AccessToken
+		username, password := "diana@example.com", "secret"
+
+		identities, err := nc.LinkCredential(context.TODO(), "local-userpass", &options.Credential{Username: &username, Password: &password})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(authorization).Should(Equal("Bearer " + access))
+		Expect(linked).Should(Equal(map[string]interface{}{"username": username, "password": password}))
+		Expect(identities).Should(HaveLen(2))
+		Expect(identities[1].ProviderType).Should(Equal("local-userpass"))
+
+		// the session of the anonymous user is kept.
+		Expect(nc.Token.RefreshToken).Should(Equal("refresh"))
+		Expect(nc.Token.Extra("user_id")).Should(Equal("5eb1"))
+		Expect(nc.Token.Extra("device_id")).Should(Equal("5eb2"))
+	})
+})
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/desteves/realm/pkg/options"
+)
+
+// Location describes where an app is deployed, as reported by the app location endpoint.
+// Apps with a LOCAL deployment model must be contacted at their regional Hostname.
+type Location struct {
+	DeploymentModel string `json:"deployment_model"`
+	Location        string `json:"location"`
+	Hostname        string `json:"hostname"`
+	WSHostname      string `json:"ws_hostname"`
+}
+
+// Locate asks Realm where the app is deployed and uses the returned hostname for all subsequent
+// auth and GraphQL requests. The location is cached, so only the first call reaches the server.
+func (c *Client) Locate(ctx context.Context) (*Location, error) {
+	if c.location != nil {
+		return c.location, nil
+	}
+	req, err := http.NewRequest("GET", c.options.AppURL()+"/location", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad location response status (%+v)", resp.StatusCode)
+	}
+	var location Location
+	err = json.NewDecoder(resp.Body).Decode(&location)
+	if err != nil {
+		return nil, err
+	}
+	c.location = &location
+	c.createEndpoint(c.endpointOptions())
+	return c.location, nil
+}
+
+// Location returns the cached app location, nil until Locate succeeds.
+func (c *Client) Location() *Location {
+	return c.location
+}
+
+// AppURL returns the root of the app endpoints, on the regional host once the app has been located.
+func (c *Client) AppURL() string {
+	return c.endpointOptions().AppURL()
+}
+
+// clientAPIURL returns the root of the client API, on the regional host once the app has been located.
+func (c *Client) clientAPIURL() string {
+	return c.endpointOptions().ClientAPIURL()
+}
+
+// endpointOptions returns the options with the base url replaced by the app hostname, if known.
+func (c *Client) endpointOptions() *options.ClientOptions {
+	if c.location == nil || c.location.Hostname == "" {
+		return c.options
+	}
+	opts := *c.options
+	opts.BaseURL = &c.location.Hostname
+	return &opts
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+)
+
+// User is the profile of the logged in user.
+type User struct {
+	ID         string     `json:"user_id"`
+	DomainID   string     `json:"domain_id"`
+	Type       string     `json:"type"` // normal or server
+	Identities []Identity `json:"identities"`
+	Data       UserData   `json:"data"`
+	// CustomData is the custom user data of the access token, if enabled for the app.
+	CustomData map[string]interface{} `json:"-"`
+}
+
+// Identity is a provider identity linked to a user.
+type Identity struct {
+	ID           string `json:"id"`
+	ProviderType string `json:"provider_type"` // e.g. anon-user, local-userpass
+	ProviderID   string `json:"provider_id"`
+}
+
+// UserData holds the profile fields filled by the identity providers, empty when unknown.
+type UserData struct {
+	Email      string `json:"email,omitempty"`
+	Name       string `json:"name,omitempty"`
+	FirstName  string `json:"first_name,omitempty"`
+	LastName   string `json:"last_name,omitempty"`
+	PictureURL string `json:"picture_url,omitempty"`
+	Gender     string `json:"gender,omitempty"`
+	Birthday   string `json:"birthday,omitempty"`
+	MinAge     string `json:"min_age,omitempty"`
+	MaxAge     string `json:"max_age,omitempty"`
+}
+
+// Profile returns the profile of the logged in user.
+func (c *Client) Profile(ctx context.Context) (*User, error) {
+	hc := c.SessionClient()
+	if hc == nil {
+		return nil, ErrNotConnected
+	}
+	var user User
+	err := doJSON(ctx, hc, "GET", c.clientAPIURL()+"/auth/profile", "", nil, &user)
+	if err != nil {
+		return nil, err
+	}
+	if claims, err := c.Claims(); err == nil {
+		user.CustomData = claims.UserData
+	}
+	return &user, nil
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/oauth2"
+)
+
+var _ = Describe("Profile", func() {
+	var server *httptest.Server
+	var nc *Client
+	var authorization string
+	BeforeEach(func() {
+		server = newRealmServer(realmHandlers{
+			clientPath("/auth/profile"): func(w http.ResponseWriter, r *http.Request) {
+				authorization = r.Header.Get("Authorization")
+				w.Write([]byte(`{"user_id":"5eb1","domain_id":"5ea0","type":"normal",
+					"identities":[{"id":"5eb3","provider_type":"anon-user","provider_id":"5ea4"},{"id":"diana@example.com","provider_type":"local-userpass","provider_id":"5ea5"}],
+					"data":{"email":"diana@example.com","name":"Diana"}}`))
+			},
+		})
+		var err error
+		nc, err = NewClient(testOptions(server))
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	It("should require a session", func() {
+		_, err := nc.Profile(context.TODO())
+		Expect(err).Should(MatchError(ErrNotConnected))
+	})
+	It("should return the typed user", func() {
+		token := jwt(map[string]interface{}{"sub": "5eb1", "exp": time.Now().Add(time.Hour).Unix(), "user_data": map[string]interface{}{"plan": "pro"}})
+		Expect(nc.ConnectWithToken(&oauth2.Token{AccessToken: token, RefreshToken: "refresh"})).Should(Succeed())
+
+		user, err := nc.Profile(context.TODO())
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(authorization).Should(Equal("Bearer " + token))
+		Expect(user.ID).Should(Equal("5eb1"))
+		Expect(user.Identities).Should(HaveLen(2))
+		Expect(user.Identities[1].ProviderType).Should(Equal("local-userpass"))
+		Expect(user.Data.Email).Should(Equal("diana@example.com"))
+		Expect(user.Data.Name).Should(Equal("Diana"))
+		Expect(user.CustomData).Should(HaveKeyWithValue("plan", "pro"))
+	})
+})
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/desteves/realm/pkg/options"
+)
+
+// Provider is a Realm authentication provider, see options.Provider.
+type Provider = options.Provider
+
+// RegisterProvider adds a provider, or replaces the one with the same name, so ClientOptions
+// using its name pass validation and log in with its payload. It is options.RegisterProvider,
+// there is a single registry.
+func RegisterProvider(p Provider) {
+	options.RegisterProvider(p)
+}
+
+// UnregisterProvider removes the provider registered under name, if any.
+func UnregisterProvider(name string) {
+	options.UnregisterProvider(name)
+}
+
+// LookupProvider returns the provider registered under name.
+func LookupProvider(name string) (Provider, bool) {
+	return options.LookupProvider(name)
+}
+
+// loginPayload builds the login body with the provider registered under name.
+// The Credential itself is not marshalled, each provider picks the fields of its payload.
+func loginPayload(name string, cred *options.Credential) (interface{}, error) {
+	p, ok := LookupProvider(name)
+	if !ok {
+		return nil, &options.FieldError{Field: "AuthMechanism", Err: options.ErrUnsupportedProvider, Expected: "one of " + strings.Join(options.ProviderNames(), ", ")}
+	}
+	return p.LoginPayload(cred)
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/desteves/realm/pkg/options"
+)
+
+// testAppID is the app served by the stub Realm server.
+const testAppID = "graphqlserver-lrnqt"
+
+// clientPath returns the path of a client API endpoint, e.g. clientPath("/auth/session").
+func clientPath(p string) string {
+	return options.ClientAPIPath + p
+}
+
+// appPath returns the path of an endpoint of the test app, e.g. appPath("/graphql").
+func appPath(p string) string {
+	return clientPath("/app/" + testAppID + p)
+}
+
+// jwt returns an unsigned token carrying the given claims.
+func jwt(claims map[string]interface{}) string {
+	b, _ := json.Marshal(claims)
+	return "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9." + base64.RawURLEncoding.EncodeToString(b) + ".c2lnbmF0dXJl"
+}
+
+// accessToken returns an access token of the user expiring in 30 minutes.
+func accessToken(userID string) string {
+	return jwt(map[string]interface{}{"sub": userID, "exp": time.Now().Add(30 * time.Minute).Unix()})
+}
+
+// realmHandlers are handlers of the stub Realm server by path, see newRealmServer.
+type realmHandlers map[string]http.HandlerFunc
+
+// newRealmServer starts a stub of the Realm client API for testAppID. By default it logs anonymous users
+// in as 5eb1 with the refresh token "refresh", refreshes and revokes any session, and answers the ping
+// webhook when authorized. handlers replace the defaults or add endpoints, keyed by path.
+func newRealmServer(handlers realmHandlers) *httptest.Server {
+	defaults := realmHandlers{
+		appPath("/auth/providers/anon-user/login"): func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"access_token":"` + accessToken("5eb1") + `","refresh_token":"refresh","user_id":"5eb1","device_id":"5eb2"}`))
+		},
+		clientPath("/auth/session"): func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case "POST":
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"access_token":"` + accessToken("5eb1") + `"}`))
+			case "DELETE":
+				w.WriteHeader(http.StatusNoContent)
+			}
+		},
+		appPath("/service/ping/incoming_webhook/test"): func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		},
+	}
+	mux := http.NewServeMux()
+	for path, h := range defaults {
+		if _, ok := handlers[path]; !ok {
+			mux.HandleFunc(path, h)
+		}
+	}
+	for path, h := range handlers {
+		mux.HandleFunc(path, h)
+	}
+	return httptest.NewServer(mux)
+}
+
+// testOptions returns options logging in anonymously to testAppID on the stub server.
+func testOptions(server *httptest.Server) *options.ClientOptions {
+	appid, provider := testAppID, "anon-user"
+	return &options.ClientOptions{AppID: &appid, AuthMechanism: &provider, BaseURL: &server.URL, WebhookBaseURL: &server.URL}
+}
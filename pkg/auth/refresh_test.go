@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/oauth2"
+)
+
+var _ = Describe("Refresh", func() {
+	var server *httptest.Server
+	var nc *Client
+	BeforeEach(func() {
+		server = newRealmServer(realmHandlers{
+			clientPath("/auth/session"): func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer refresh" {
+					w.WriteHeader(http.StatusUnauthorized)
+					w.Write([]byte(`{"error":"invalid session","error_code":"InvalidSession"}`))
+					return
+				}
+				if r.Method == "POST" {
+					w.WriteHeader(http.StatusCreated)
+					w.Write([]byte(`{"access_token":"` + accessToken("5eb1") + `"}`))
+				}
+			},
+		})
+		var err error
+		nc, err = NewClient(testOptions(server))
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	It("should require a session", func() {
+		Expect(nc.Refresh(context.TODO())).Should(MatchError(ErrNotConnected))
+	})
+	It("should refresh a token which has not expired", func() {
+		Expect(nc.ConnectWithToken(&oauth2.Token{AccessToken: "rejected", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)})).Should(Succeed())
+		Expect(nc.Refresh(context.TODO())).Should(Succeed())
+		Expect(nc.Token.AccessToken).ShouldNot(Equal("rejected"))
+		Expect(nc.Token.RefreshToken).Should(Equal("refresh"))
+	})
+	It("should return ErrRefreshRejected for a revoked refresh token", func() {
+		Expect(nc.ConnectWithToken(&oauth2.Token{AccessToken: "expired", RefreshToken: "revoked", Expiry: time.Now().Add(-time.Minute)})).Should(Succeed())
+		err := nc.Refresh(context.TODO())
+		Expect(errors.Is(err, ErrRefreshRejected)).Should(BeTrue())
+		Expect(errors.Is(err, ErrInvalidSession)).Should(BeTrue())
+		var rerr *RefreshError
+		Expect(errors.As(err, &rerr)).Should(BeTrue())
+		Expect(rerr.Err.StatusCode).Should(Equal(http.StatusUnauthorized))
+
+		// requests fail with it too, wrapped in a *url.Error.
+		err = nc.Ping()
+		Expect(errors.Is(err, ErrRefreshRejected)).Should(BeTrue())
+	})
+	It("should log in again", func() {
+		Expect(nc.ConnectWithToken(&oauth2.Token{AccessToken: "rejected", RefreshToken: "revoked", Expiry: time.Now().Add(time.Hour)})).Should(Succeed())
+		Expect(nc.Login(context.TODO())).Should(Succeed())
+		Expect(nc.Token.RefreshToken).Should(Equal("refresh"))
+		Expect(nc.Ping()).Should(Succeed())
+	})
+	Describe("Reauthenticate", func() {
+		It("should require a session", func() {
+			Expect(nc.Reauthenticate(context.TODO(), "rejected", false, true)).Should(MatchError(ErrNotConnected))
+		})
+		It("should only replace the rejected access token", func() {
+			Expect(nc.ConnectWithToken(&oauth2.Token{AccessToken: "rejected", RefreshToken: "revoked", Expiry: time.Now().Add(time.Hour)})).Should(Succeed())
+			hc := nc.HTTPClient
+
+			Expect(nc.Reauthenticate(context.TODO(), "replaced", false, true)).Should(Succeed())
+			Expect(nc.CurrentToken().AccessToken).Should(Equal("rejected"))
+
+			Expect(errors.Is(nc.Reauthenticate(context.TODO(), "rejected", false, false), ErrRefreshRejected)).Should(BeTrue())
+			Expect(nc.Reauthenticate(context.TODO(), "rejected", false, true)).Should(Succeed())
+			Expect(nc.CurrentToken().RefreshToken).Should(Equal("refresh"))
+			Expect(nc.Token).Should(Equal(nc.CurrentToken()))
+			// the session is kept, so the http client in use sends the new token.
+			Expect(nc.HTTPClient).Should(BeIdenticalTo(hc))
+			Expect(nc.Ping()).Should(Succeed())
+		})
+		It("should not refresh again after a rejected refresh", func() {
+			Expect(nc.ConnectWithToken(&oauth2.Token{AccessToken: "expired", RefreshToken: "revoked", Expiry: time.Now().Add(-time.Minute)})).Should(Succeed())
+			Expect(errors.Is(nc.Ping(), ErrRefreshRejected)).Should(BeTrue())
+
+			Expect(nc.Reauthenticate(context.TODO(), "expired", true, false)).Should(MatchError(ErrRefreshRejected))
+			Expect(nc.CurrentToken().AccessToken).Should(Equal("expired"))
+			Expect(nc.Reauthenticate(context.TODO(), "expired", true, true)).Should(Succeed())
+			Expect(nc.CurrentToken().RefreshToken).Should(Equal("refresh"))
+			Expect(nc.Ping()).Should(Succeed())
+		})
+	})
+})
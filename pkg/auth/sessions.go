@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/desteves/realm/pkg/options"
+	"golang.org/x/oauth2"
+)
+
+// ErrNoSession is returned by Sessions for a user without a session.
+var ErrNoSession = errors.New("realm: no session for the user")
+
+// RevokeError is returned with the new session by Sessions.Login and Sessions.Add when the replaced session
+// of the user could not be revoked with Realm. The new session is kept and active, the replaced client is
+// disconnected anyway, so the error is only worth logging.
+type RevokeError struct {
+	UserID string
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *RevokeError) Error() string {
+	return "realm: replaced session of user " + e.UserID + " not revoked: " + e.Err.Error()
+}
+
+// Unwrap returns the error of the revocation.
+func (e *RevokeError) Unwrap() error {
+	return e.Err
+}
+
+// Sessions holds the sessions of several users of the same app, keyed by user id, e.g. for a backend acting
+// on behalf of many end users. Each session is a Client refreshing its own token. The clients wrap the transport
+// of ClientOptions.HTTPClient (http.DefaultTransport by default), so they share its connections.
+// It is safe for concurrent use.
+type Sessions struct {
+	Hooks Hooks // given to the clients of Login
+
+	options *options.ClientOptions
+
+	mu      sync.Mutex
+	clients map[string]*Client
+	active  string
+}
+
+// NewSessions creates an empty set of sessions. The options are shared by the clients of the sessions,
+// except for the AuthMechanism and Credential given to Login.
+func NewSessions(opts *options.ClientOptions) *Sessions {
+	return &Sessions{options: opts, clients: map[string]*Client{}}
+}
+
+// Login logs in a user with the credential for the provider, and makes it the active user.
+// A previous session of the same user is replaced and disconnected. If it could not be revoked, the client
+// is returned along with a *RevokeError.
+func (s *Sessions) Login(ctx context.Context, provider string, credential *options.Credential) (*Client, error) {
+	opts := *s.options
+	opts.AuthMechanism = &provider
+	opts.Credential = credential
+	c, err := NewClient(&opts)
+	if err != nil {
+		return nil, err
+	}
+	c.Hooks = s.Hooks
+	err = c.ConnectContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.Add(ctx, c)
+	var rerr *RevokeError
+	if err != nil && !errors.As(err, &rerr) {
+		return nil, err
+	}
+	return c, err
+}
+
+// Add adds the session of a connected client, e.g. restored with ConnectWithToken, and makes it the active user.
+// A previous session of the same user is replaced and disconnected. The user id is returned, along with
+// a *RevokeError if the previous session could not be revoked.
+func (s *Sessions) Add(ctx context.Context, c *Client) (string, error) {
+	source := c.session()
+	if source == nil {
+		return "", ErrNotConnected
+	}
+	id, err := userID(source.current())
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	previous := s.clients[id]
+	s.clients[id] = c
+	s.active = id
+	s.mu.Unlock()
+
+	if previous != nil && previous != c {
+		if err := previous.Disconnect(ctx); err != nil {
+			return id, &RevokeError{UserID: id, Err: err}
+		}
+	}
+	return id, nil
+}
+
+// Client returns the client of the user, or ErrNoSession.
+func (s *Sessions) Client(userID string) (*Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.clients[userID]
+	if !ok {
+		return nil, ErrNoSession
+	}
+	return c, nil
+}
+
+// Active returns the client of the active user, or ErrNoSession if there is none.
+func (s *Sessions) Active() (*Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.clients[s.active]
+	if !ok {
+		return nil, ErrNoSession
+	}
+	return c, nil
+}
+
+// SwitchUser makes the user the active one.
+func (s *Sessions) SwitchUser(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[userID]; !ok {
+		return ErrNoSession
+	}
+	s.active = userID
+	return nil
+}
+
+// Users returns the sorted ids of the users with a session.
+func (s *Sessions) Users() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.clients))
+	for id := range s.clients {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Logout removes the session of the user and disconnects its client. If it was the active user, there is none left.
+func (s *Sessions) Logout(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	c, ok := s.clients[userID]
+	delete(s.clients, userID)
+	if s.active == userID {
+		s.active = ""
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return ErrNoSession
+	}
+	return c.Disconnect(ctx)
+}
+
+// EvictIdle logs out the users without a request for longer than maxIdle and returns their ids.
+// It is meant to be called periodically. All idle sessions are removed, the first disconnect error is returned.
+func (s *Sessions) EvictIdle(ctx context.Context, maxIdle time.Duration) ([]string, error) {
+	// the sessions are checked and removed at once, so a user logging in again meanwhile keeps the new session.
+	var idle []string
+	var clients []*Client
+	now := timeNow()
+	s.mu.Lock()
+	for id, c := range s.clients {
+		if source := c.session(); source == nil || now.Sub(source.lastUsed()) > maxIdle {
+			idle = append(idle, id)
+			clients = append(clients, c)
+			delete(s.clients, id)
+			if s.active == id {
+				s.active = ""
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	var first error
+	for _, c := range clients {
+		err := c.Disconnect(ctx)
+		if err != nil && err != ErrNotConnected && first == nil {
+			first = err
+		}
+	}
+	sort.Strings(idle)
+	return idle, first
+}
+
+// userID returns the user id of the login response, falling back to the subject of the access token.
+func userID(t *oauth2.Token) (string, error) {
+	if id, ok := t.Extra("user_id").(string); ok && id != "" {
+		return id, nil
+	}
+	claims, err := parseClaims(t.AccessToken)
+	if err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/desteves/realm/pkg/options"
+)
+
+var _ = Describe("Sessions", func() {
+	var server *httptest.Server
+	var sessions *Sessions
+	var revoked []string
+	var revokeFails bool
+	var now time.Time
+	BeforeEach(func() {
+		revoked, revokeFails = nil, false
+		now = time.Now()
+		timeNow = func() time.Time { return now }
+		server = newRealmServer(realmHandlers{
+			appPath("/auth/providers/local-userpass/login"): func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]string
+				json.NewDecoder(r.Body).Decode(&body)
+				w.Write([]byte(`{"access_token":"` + accessToken(body["username"]) + `","refresh_token":"refresh-` + body["username"] + `","user_id":"` + body["username"] + `"}`))
+			},
+			clientPath("/auth/session"): func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "DELETE" {
+					if revokeFails {
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+					revoked = append(revoked, r.Header.Get("Authorization"))
+					w.WriteHeader(http.StatusNoContent)
+				}
+			},
+		})
+		sessions = NewSessions(testOptions(server))
+	})
+	AfterEach(func() {
+		server.Close()
+		timeNow = time.Now
+	})
+	login := func(username string) *Client {
+		password := "secret"
+		c, err := sessions.Login(context.TODO(), "local-userpass", &options.Credential{Username: &username, Password: &password})
+		Expect(err).ShouldNot(HaveOccurred())
+		return c
+	}
+	It("should have no active user at first", func() {
+		_, err := sessions.Active()
+		Expect(err).Should(MatchError(ErrNoSession))
+		Expect(sessions.Users()).Should(BeEmpty())
+	})
+	It("should only add connected clients", func() {
+		c, err := NewClient(testOptions(server))
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = sessions.Add(context.TODO(), c)
+		Expect(err).Should(MatchError(ErrNotConnected))
+		c.HTTPClient = server.Client()
+		_, err = sessions.Add(context.TODO(), c)
+		Expect(err).Should(MatchError(ErrNotConnected))
+	})
+	It("should keep a session per user", func() {
+		diana := login("diana")
+		bruce := login("bruce")
+		Expect(sessions.Users()).Should(Equal([]string{"bruce", "diana"}))
+		Expect(diana.Token.RefreshToken).Should(Equal("refresh-diana"))
+		Expect(bruce.Token.RefreshToken).Should(Equal("refresh-bruce"))
+
+		c, err := sessions.Client("diana")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(c).Should(BeIdenticalTo(diana))
+		_, err = sessions.Client("clark")
+		Expect(err).Should(MatchError(ErrNoSession))
+	})
+	It("should switch the active user", func() {
+		diana := login("diana")
+		bruce := login("bruce")
+		active, err := sessions.Active()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(active).Should(BeIdenticalTo(bruce))
+
+		Expect(sessions.SwitchUser("diana")).Should(Succeed())
+		active, err = sessions.Active()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(active).Should(BeIdenticalTo(diana))
+		Expect(sessions.SwitchUser("clark")).Should(MatchError(ErrNoSession))
+	})
+	It("should replace the previous session of a user", func() {
+		previous := login("diana")
+		login("diana")
+		Expect(sessions.Users()).Should(Equal([]string{"diana"}))
+		Expect(previous.HTTPClient).Should(BeNil())
+		Expect(revoked).Should(Equal([]string{"Bearer refresh-diana"}))
+	})
+	It("should keep the new session when the previous one cannot be revoked", func() {
+		previous := login("diana")
+		revokeFails = true
+		username, password := "diana", "secret"
+		c, err := sessions.Login(context.TODO(), "local-userpass", &options.Credential{Username: &username, Password: &password})
+		var rerr *RevokeError
+		Expect(errors.As(err, &rerr)).Should(BeTrue())
+		Expect(rerr.UserID).Should(Equal("diana"))
+		Expect(c).ShouldNot(BeNil())
+		Expect(c.HTTPClient).ShouldNot(BeNil())
+		Expect(previous.HTTPClient).Should(BeNil())
+
+		active, err := sessions.Active()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(active).Should(BeIdenticalTo(c))
+	})
+	It("should log out a user", func() {
+		diana := login("diana")
+		Expect(sessions.Logout(context.TODO(), "diana")).Should(Succeed())
+		Expect(diana.HTTPClient).Should(BeNil())
+		Expect(sessions.Users()).Should(BeEmpty())
+		_, err := sessions.Active()
+		Expect(err).Should(MatchError(ErrNoSession))
+		Expect(sessions.Logout(context.TODO(), "diana")).Should(MatchError(ErrNoSession))
+	})
+	It("should evict the idle sessions", func() {
+		login("diana")
+		now = now.Add(time.Hour)
+		login("bruce")
+
+		evicted, err := sessions.EvictIdle(context.TODO(), 30*time.Minute)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(evicted).Should(Equal([]string{"diana"}))
+		Expect(sessions.Users()).Should(Equal([]string{"bruce"}))
+		Expect(revoked).Should(Equal([]string{"Bearer refresh-diana"}))
+	})
+	It("should evict the sessions used concurrently", func() {
+		diana := login("diana")
+		now = now.Add(time.Hour)
+		done := make(chan error)
+		go func() {
+			done <- diana.Ping()
+		}()
+		evicted, err := sessions.EvictIdle(context.TODO(), 30*time.Minute)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(evicted).Should(Equal([]string{"diana"}))
+		if err := <-done; err != nil {
+			Expect(err).Should(MatchError(ErrNotConnected))
+		}
+		Expect(diana.SessionClient()).Should(BeNil())
+	})
+	It("should keep the session of a user who logged in again", func() {
+		login("diana")
+		now = now.Add(time.Hour)
+		diana := login("diana")
+
+		evicted, err := sessions.EvictIdle(context.TODO(), 30*time.Minute)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(evicted).Should(BeEmpty())
+		c, err := sessions.Client("diana")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(c).Should(BeIdenticalTo(diana))
+		Expect(diana.HTTPClient).ShouldNot(BeNil())
+	})
+})
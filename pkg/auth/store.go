@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrTokenNotFound is returned by TokenStore.Load when no token is stored under the key.
+var ErrTokenNotFound = errors.New("realm: no stored token")
+
+// TokenStore persists the token of a session, so a process can resume it after a restart instead of logging in again.
+// The key identifies the app, provider and user of the session, see Client.Store.
+type TokenStore interface {
+	Load(key string) (*oauth2.Token, error)
+	Save(key string, t *oauth2.Token) error
+	Delete(key string) error
+}
+
+// tokenExtras are the Token.Extra fields of the login response kept for the session.
+var tokenExtras = []string{"user_id", "device_id"}
+
+// storedToken is the JSON form of a token, oauth2.Token does not marshal its extra fields.
+type storedToken struct {
+	AccessToken  string                 `json:"access_token"`
+	RefreshToken string                 `json:"refresh_token"`
+	Expiry       time.Time              `json:"expiry,omitempty"`
+	Extra        map[string]interface{} `json:"extra,omitempty"`
+}
+
+func newStoredToken(t *oauth2.Token) *storedToken {
+	st := &storedToken{AccessToken: t.AccessToken, RefreshToken: t.RefreshToken, Expiry: t.Expiry, Extra: map[string]interface{}{}}
+	for _, key := range tokenExtras {
+		if v := t.Extra(key); v != nil {
+			st.Extra[key] = v
+		}
+	}
+	return st
+}
+
+func (st *storedToken) token() *oauth2.Token {
+	t := &oauth2.Token{AccessToken: st.AccessToken, RefreshToken: st.RefreshToken, TokenType: "Bearer", Expiry: st.Expiry}
+	return t.WithExtra(st.Extra)
+}
+
+// FileTokenStore stores each token in a JSON file only readable by the user, named after the key.
+type FileTokenStore struct {
+	dir string
+}
+
+// NewFileTokenStore creates a store in dir, by default a realm directory under os.UserConfigDir.
+func NewFileTokenStore(dir string) (*FileTokenStore, error) {
+	if dir == "" {
+		config, err := os.UserConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(config, "realm")
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &FileTokenStore{dir: dir}, nil
+}
+
+func (s *FileTokenStore) path(key string) string {
+	return filepath.Join(s.dir, url.PathEscape(key)+".json")
+}
+
+// Load implements TokenStore.
+func (s *FileTokenStore) Load(key string) (*oauth2.Token, error) {
+	b, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st storedToken
+	err = json.Unmarshal(b, &st)
+	if err != nil {
+		return nil, err
+	}
+	return st.token(), nil
+}
+
+// Save implements TokenStore. The file is replaced atomically.
+func (s *FileTokenStore) Save(key string, t *oauth2.Token) error {
+	b, err := json.Marshal(newStoredToken(t))
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(s.dir, ".token-*") // created with 0600
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Delete implements TokenStore. Deleting a missing token is not an error.
+func (s *FileTokenStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// MemoryTokenStore keeps the tokens in memory, e.g. for tests or to share them between the clients of a process.
+// It is safe for concurrent use.
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]*storedToken
+}
+
+// NewMemoryTokenStore creates an empty store.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: map[string]*storedToken{}}
+}
+
+// Load implements TokenStore.
+func (s *MemoryTokenStore) Load(key string) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.tokens[key]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	return st.token(), nil
+}
+
+// Save implements TokenStore.
+func (s *MemoryTokenStore) Save(key string, t *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[key] = newStoredToken(t)
+	return nil
+}
+
+// Delete implements TokenStore.
+func (s *MemoryTokenStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, key)
+	return nil
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/oauth2"
+
+	"github.com/desteves/realm/pkg/options"
+)
+
+var _ = Describe("TokenStore", func() {
+	token := (&oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour).Round(time.Second)}).
+		WithExtra(map[string]interface{}{"user_id": "5eb1", "device_id": "5eb2"})
+	expectStored := func(t *oauth2.Token) {
+		Expect(t.AccessToken).Should(Equal("access"))
+		Expect(t.RefreshToken).Should(Equal("refresh"))
+		Expect(t.Expiry.Equal(token.Expiry)).Should(BeTrue())
+		Expect(t.Extra("user_id")).Should(Equal("5eb1"))
+		Expect(t.Extra("device_id")).Should(Equal("5eb2"))
+	}
+	Context("in memory", func() {
+		It("should save, load and delete tokens", func() {
+			store := NewMemoryTokenStore()
+			_, err := store.Load("app/anon-user")
+			Expect(err).Should(MatchError(ErrTokenNotFound))
+			Expect(store.Save("app/anon-user", token)).Should(Succeed())
+			t, err := store.Load("app/anon-user")
+			Expect(err).ShouldNot(HaveOccurred())
+			expectStored(t)
+			Expect(store.Delete("app/anon-user")).Should(Succeed())
+			_, err = store.Load("app/anon-user")
+			Expect(err).Should(MatchError(ErrTokenNotFound))
+		})
+	})
+	Context("in files", func() {
+		var dir string
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "realm")
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+		It("should save, load and delete tokens", func() {
+			store, err := NewFileTokenStore(dir)
+			Expect(err).ShouldNot(HaveOccurred())
+			_, err = store.Load("app/local-userpass/diana@example.com")
+			Expect(err).Should(MatchError(ErrTokenNotFound))
+			Expect(store.Save("app/local-userpass/diana@example.com", token)).Should(Succeed())
+
+			files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(files).Should(HaveLen(1))
+			info, err := os.Stat(files[0])
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(info.Mode().Perm()).Should(Equal(os.FileMode(0600)))
+
+			t, err := store.Load("app/local-userpass/diana@example.com")
+			Expect(err).ShouldNot(HaveOccurred())
+			expectStored(t)
+			Expect(store.Delete("app/local-userpass/diana@example.com")).Should(Succeed())
+			Expect(store.Delete("app/local-userpass/diana@example.com")).Should(Succeed())
+			_, err = store.Load("app/local-userpass/diana@example.com")
+			Expect(err).Should(MatchError(ErrTokenNotFound))
+		})
+	})
+	Context("used by the client", func() {
+		var server *httptest.Server
+		var opts *options.ClientOptions
+		var store *MemoryTokenStore
+		var logins, refreshes int32
+		BeforeEach(func() {
+			atomic.StoreInt32(&logins, 0)
+			atomic.StoreInt32(&refreshes, 0)
+			server = newRealmServer(realmHandlers{
+				appPath("/auth/providers/anon-user/login"): func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&logins, 1)
+					w.Write([]byte(`{"access_token":"` + accessToken("5eb1") + `","refresh_token":"refresh","user_id":"5eb1","device_id":"5eb2"}`))
+				},
+				appPath("/auth/providers/api-key/login"): func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&logins, 1)
+					var body map[string]string
+					json.NewDecoder(r.Body).Decode(&body)
+					w.Write([]byte(`{"access_token":"` + accessToken(body["key"]) + `","refresh_token":"refresh","user_id":"` + body["key"] + `"}`))
+				},
+				clientPath("/auth/session"): func(w http.ResponseWriter, r *http.Request) {
+					if r.Header.Get("Authorization") != "Bearer refresh" {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					if r.Method == "POST" {
+						// each refresh issues a distinct access token.
+						n := atomic.AddInt32(&refreshes, 1)
+						access := jwt(map[string]interface{}{"sub": "5eb1", "exp": time.Now().Add(30 * time.Minute).Unix(), "n": n})
+						w.WriteHeader(http.StatusCreated)
+						w.Write([]byte(`{"access_token":"` + access + `"}`))
+					}
+				},
+			})
+			opts = testOptions(server)
+			store = NewMemoryTokenStore()
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		connect := func() *Client {
+			nc, err := NewClient(opts)
+			Expect(err).ShouldNot(HaveOccurred())
+			nc.Store = store
+			Expect(nc.Connect()).Should(Succeed())
+			return nc
+		}
+		// key returns the key of the session in the store.
+		key := func() string {
+			nc, err := NewClient(opts)
+			Expect(err).ShouldNot(HaveOccurred())
+			k, err := nc.storeKey()
+			Expect(err).ShouldNot(HaveOccurred())
+			return k
+		}
+		It("should resume the stored session", func() {
+			first := connect()
+			second := connect()
+			Expect(atomic.LoadInt32(&logins)).Should(Equal(int32(1)))
+			Expect(second.Token.AccessToken).Should(Equal(first.Token.AccessToken))
+			Expect(second.Token.Extra("user_id")).Should(Equal("5eb1"))
+		})
+		It("should refresh an expired stored token", func() {
+			store.Save(key(), (&oauth2.Token{AccessToken: "stale", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)}).
+				WithExtra(map[string]interface{}{"user_id": "5eb1"}))
+			nc := connect()
+			Expect(atomic.LoadInt32(&logins)).Should(Equal(int32(0)))
+			Expect(nc.Token.AccessToken).ShouldNot(Equal("stale"))
+			t, err := store.Load(key())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(t.AccessToken).Should(Equal(nc.Token.AccessToken))
+		})
+		It("should log in when the stored token cannot be refreshed", func() {
+			store.Save(key(), &oauth2.Token{AccessToken: "stale", RefreshToken: "revoked", Expiry: time.Now().Add(-time.Minute)})
+			nc := connect()
+			Expect(atomic.LoadInt32(&logins)).Should(Equal(int32(1)))
+			Expect(nc.Token.RefreshToken).Should(Equal("refresh"))
+		})
+		It("should delete the session on disconnect", func() {
+			nc := connect()
+			Expect(nc.Disconnect(context.TODO())).Should(Succeed())
+			_, err := store.Load(key())
+			Expect(err).Should(MatchError(ErrTokenNotFound))
+		})
+		It("should save the refreshed token", func() {
+			nc := connect()
+			Expect(nc.Refresh(context.TODO())).Should(Succeed())
+			t, err := store.Load(key())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(t.AccessToken).Should(Equal(nc.Token.AccessToken))
+			Expect(t.Extra("user_id")).Should(Equal("5eb1"))
+		})
+		It("should keep a session per credential", func() {
+			provider := "api-key"
+			opts.AuthMechanism = &provider
+			opts.Credential = options.ServerAPIKey("diana")
+			diana := connect()
+			opts.Credential = options.ServerAPIKey("bruce")
+			bruce := connect()
+			Expect(atomic.LoadInt32(&logins)).Should(Equal(int32(2)))
+			Expect(bruce.Token.Extra("user_id")).Should(Equal("bruce"))
+
+			opts.Credential = options.ServerAPIKey("diana")
+			Expect(connect().Token.AccessToken).Should(Equal(diana.Token.AccessToken))
+			Expect(atomic.LoadInt32(&logins)).Should(Equal(int32(2)))
+			Expect(key()).ShouldNot(ContainSubstring("diana"))
+		})
+	})
+})
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// timeNow is the clock of the idle time of the sessions, replaced in tests.
+var timeNow = time.Now
+
+// tokenSource is an oauth2.TokenSource implementing Realm's refresh protocol, which is
+// a POST to /auth/session with the refresh token as bearer and an empty body.
+// The refresh token and the Token.Extra fields (user_id, device_id) are kept across refreshes.
+// It is safe for concurrent use: the refresh request is sent without the lock held and
+// concurrent callers wait for the same refresh instead of sending their own.
+type tokenSource struct {
+	ctx       context.Context // only used to look up the oauth2.HTTPClient
+	url       string
+	refreshed func(t *oauth2.Token, err error) // optional, called after every refresh attempt without the lock held
+
+	mu       sync.Mutex
+	t        *oauth2.Token
+	used     time.Time    // last time the token was handed out
+	inflight *refreshCall // the refresh being sent, if any
+}
+
+// refreshCall is a refresh shared by the callers which needed it while it was sent.
+type refreshCall struct {
+	done chan struct{}
+	t    *oauth2.Token
+	err  error
+}
+
+func newTokenSource(ctx context.Context, url string, t *oauth2.Token) *tokenSource {
+	return &tokenSource{ctx: ctx, url: url, t: t, used: timeNow()}
+}
+
+// Token returns the current token, refreshing it first if it has expired.
+func (s *tokenSource) Token() (*oauth2.Token, error) {
+	return s.tokenContext(context.Background())
+}
+
+// tokenContext is Token with a context for the refresh request.
+func (s *tokenSource) tokenContext(ctx context.Context) (*oauth2.Token, error) {
+	return s.token(ctx, false)
+}
+
+// token returns the current token, refreshing it first if it has expired or force is set.
+// A caller joining a refresh sent by another one stops waiting when its context is done.
+func (s *tokenSource) token(ctx context.Context, force bool) (*oauth2.Token, error) {
+	s.mu.Lock()
+	s.used = timeNow()
+	if !force && s.t.Valid() {
+		t := s.t
+		s.mu.Unlock()
+		return t, nil
+	}
+	if call := s.inflight; call != nil {
+		s.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.t, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	s.inflight = call
+	previous := s.t
+	s.mu.Unlock()
+
+	call.t, call.err = s.refresh(ctx, previous)
+
+	s.mu.Lock()
+	if call.err == nil {
+		s.t = call.t
+	}
+	s.inflight = nil
+	s.mu.Unlock()
+	close(call.done)
+
+	if s.refreshed != nil {
+		s.refreshed(call.t, call.err)
+	}
+	return call.t, call.err
+}
+
+// current returns the last token without refreshing it.
+func (s *tokenSource) current() *oauth2.Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.t
+}
+
+// replace makes t the token of the source, e.g. after a new login.
+func (s *tokenSource) replace(t *oauth2.Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.t = t
+}
+
+// lastUsed returns the last time the token was handed out, i.e. the last request of the session.
+func (s *tokenSource) lastUsed() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
+}
+
+// refresh exchanges the refresh token of previous for a new access token.
+func (s *tokenSource) refresh(ctx context.Context, previous *oauth2.Token) (*oauth2.Token, error) {
+	if previous == nil || previous.RefreshToken == "" {
+		return nil, fmt.Errorf("cannot refresh the access token without a refresh token")
+	}
+	req, err := http.NewRequest("POST", s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+previous.RefreshToken)
+	resp, err := contextClient(s.ctx).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &RefreshError{Err: newServiceError(resp)}
+	}
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return nil, err
+	}
+	if body.AccessToken == "" {
+		return nil, fmt.Errorf("refresh response is missing the access token")
+	}
+
+	// copying keeps the refresh token and the extra fields of the login response.
+	t := *previous
+	t.AccessToken = body.AccessToken
+	t.Expiry = time.Time{}
+	setExpiry(&t)
+	return &t, nil
+}
+
+// setExpiry fills in the expiry Realm does not send back, reading it from the access token claims.
+func setExpiry(t *oauth2.Token) {
+	if !t.Expiry.IsZero() {
+		return
+	}
+	if claims, err := parseClaims(t.AccessToken); err == nil && claims.ExpiresAt > 0 {
+		t.Expiry = claims.Expiry()
+		return
+	}
+	// the token could not be decoded. The docs say 30 mins, so setting it to 29
+	// https://docs.mongodb.com/stitch/graphql/authenticate-graphql-requests/#refresh-a-client-api-access-token
+	t.Expiry = time.Now().Add(time.Minute * 29)
+}
+
+// transport authenticates requests with the access token. Unlike oauth2.Transport, it refreshes
+// the token with the context of the request being sent, so a deadline also bounds the refresh.
+type transport struct {
+	base   http.RoundTripper
+	source *tokenSource
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.source.tokenContext(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	token.SetAuthHeader(r)
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r)
+}
+
+// contextClient returns the http client stored under the oauth2.HTTPClient context key, same as the oauth2 package does.
+func contextClient(ctx context.Context) *http.Client {
+	if ctx != nil {
+		if hc, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+			return hc
+		}
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,196 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PathSegment returned when the response had an error. Path segments that represent fields should be strings, and path segments that represent list indices should be 0‐indexed integers. If the error happens in an aliased field, the path to the error should use the aliased name, since it represents a path in the response, not in the query.
+type PathSegment struct {
+	parent *PathSegment
+	value  interface{}
+}
+
+func (p *PathSegment) toSlice() []interface{} {
+	if p == nil || (p.parent == nil && p.value == nil) {
+		return nil
+	}
+	return append(p.parent.toSlice(), p.value)
+}
+
+// Segments returns the path from the root of the response, fields as strings and list indices as ints.
+func (p *PathSegment) Segments() []interface{} {
+	return p.toSlice()
+}
+
+// String renders the path the way it would be written in Go or JavaScript, e.g. hero[0].name
+func (p *PathSegment) String() string {
+	var b strings.Builder
+	for i, s := range p.toSlice() {
+		switch v := s.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", v)
+		default:
+			if i > 0 {
+				b.WriteString(".")
+			}
+			fmt.Fprint(&b, v)
+		}
+	}
+	return b.String()
+}
+
+// MarshalJSON encodes the path as the array of segments defined by the spec, e.g. ["hero", 0, "name"]
+func (p *PathSegment) MarshalJSON() ([]byte, error) {
+	segments := p.toSlice()
+	if segments == nil {
+		segments = []interface{}{}
+	}
+	return json.Marshal(segments)
+}
+
+// UnmarshalJSON decodes the array of segments defined by the spec, e.g. ["hero", 0, "name"]
+func (p *PathSegment) UnmarshalJSON(data []byte) error {
+	var segments []interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&segments); err != nil {
+		return err
+	}
+	var parent *PathSegment
+	for i, s := range segments {
+		switch v := s.(type) {
+		case string:
+		case json.Number:
+			n, err := v.Int64()
+			if err != nil {
+				return fmt.Errorf("path segment %d is not a list index: %v", i, v)
+			}
+			s = int(n)
+		default:
+			return fmt.Errorf("path segment %d must be a string or an integer, got %T", i, v)
+		}
+		if i == len(segments)-1 {
+			*p = PathSegment{parent: parent, value: s}
+			return nil
+		}
+		parent = &PathSegment{parent: parent, value: s}
+	}
+	*p = PathSegment{}
+	return nil
+}
+
+// Location returned when the response had an error. Each location is a map with the keys line and column, both positive numbers starting from 1 which describe the beginning of an associated syntax element
+type Location struct {
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// Error is a GraphQL Error as per http://spec.graphql.org/June2018/#sec-Errors
+type Error struct {
+	Message    string                 `json:"message,omitempty"`
+	Path       *PathSegment           `json:"path,omitempty"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Error implements the error interface.
+func (e Error) Error() string {
+	var details []string
+	if path := e.Path.String(); path != "" {
+		details = append(details, "path "+path)
+	}
+	if len(e.Locations) > 0 {
+		details = append(details, fmt.Sprintf("line %d, column %d", e.Locations[0].Line, e.Locations[0].Column))
+	}
+	if len(details) == 0 {
+		return "graphql: " + e.Message
+	}
+	return fmt.Sprintf("graphql: %s (%s)", e.Message, strings.Join(details, ", "))
+}
+
+// Is reports whether target is a GraphQL Error with the same message.
+func (e Error) Is(target error) bool {
+	switch t := target.(type) {
+	case Error:
+		return t.Message == e.Message
+	case *Error:
+		return t != nil && t.Message == e.Message
+	}
+	return false
+}
+
+// Errors holds the errors array of a GraphQL response. It is returned by Query and Mutate
+// whenever the server reports at least one error.
+type Errors []Error
+
+// Error implements the error interface.
+func (e Errors) Error() string {
+	switch len(e) {
+	case 0:
+		return "graphql: no errors"
+	case 1:
+		return e[0].Error()
+	}
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d errors occurred: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Is reports whether any of the errors matches target.
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error that matches target, which may be a *Error or an **Error.
+func (e Errors) As(target interface{}) bool {
+	for i := range e {
+		if errors.As(e[i], target) || errors.As(&e[i], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrUnauthorized is matched by *UnauthorizedError, usable with errors.Is.
+var ErrUnauthorized = errors.New("graphql: unauthorized")
+
+// UnauthorizedError is returned when the GraphQL server answered 401 Unauthorized, or the expired access token
+// could not be refreshed, and the request could not be replayed with a new token according to
+// options.ClientOptions.ReauthPolicy.
+type UnauthorizedError struct {
+	Err  error  // why re-authenticating failed or the refresh error, nil when the server answered 401
+	Body []byte // of the last 401 response, if any
+}
+
+// Error implements the error interface.
+func (e *UnauthorizedError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: cannot re-authenticate: %v", ErrUnauthorized, e.Err)
+	}
+	if len(e.Body) > 0 {
+		return fmt.Sprintf("%s: %q", ErrUnauthorized, e.Body)
+	}
+	return ErrUnauthorized.Error()
+}
+
+// Is reports whether target is ErrUnauthorized.
+func (e *UnauthorizedError) Is(target error) bool {
+	return target == ErrUnauthorized
+}
+
+// Unwrap returns the re-authentication error.
+func (e *UnauthorizedError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,74 @@
+package graphql
+
+import (
+	"context"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/desteves/realm/pkg/auth"
+)
+
+var _ = Describe("ForUser", func() {
+	var server *httptest.Server
+	var nc *Client
+	var sessions *auth.Sessions
+	BeforeEach(func() {
+		server = newRealmServer(nil)
+		opts := testOptions(server)
+		var err error
+		nc, err = NewClient(opts)
+		Expect(err).ShouldNot(HaveOccurred())
+		sessions = auth.NewSessions(opts)
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	It("should query as the user of the sessions", func() {
+		_, err := sessions.Login(context.TODO(), "anon-user", nil)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		view, err := nc.ForUser(sessions, "5eb1")
+		Expect(err).ShouldNot(HaveOccurred())
+		var q struct {
+			Name string
+		}
+		var response Response
+		Expect(view.Query(context.TODO(), &q, nil, &response)).Should(Succeed())
+		Expect(q.Name).Should(Equal("diana"))
+
+		view, err = nc.ForActiveUser(sessions)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(view.Query(context.TODO(), &q, nil, &response)).Should(Succeed())
+	})
+	It("should let queries in flight run while the user logs out", func() {
+		_, err := sessions.Login(context.TODO(), "anon-user", nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		view, err := nc.ForUser(sessions, "5eb1")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		errs := make(chan error, 8)
+		for i := 0; i < cap(errs); i++ {
+			go func() {
+				var q struct {
+					Name string
+				}
+				var response Response
+				errs <- view.Query(context.TODO(), &q, nil, &response)
+			}()
+		}
+		Expect(sessions.Logout(context.TODO(), "5eb1")).Should(Succeed())
+		for i := 0; i < cap(errs); i++ {
+			if err := <-errs; err != nil {
+				Expect(err).Should(MatchError(ErrNotConnected))
+			}
+		}
+	})
+	It("should not return a view without a session", func() {
+		_, err := nc.ForUser(sessions, "5eb1")
+		Expect(err).Should(MatchError(auth.ErrNoSession))
+		_, err = nc.ForActiveUser(sessions)
+		Expect(err).Should(MatchError(auth.ErrNoSession))
+	})
+})
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"reflect"
 
 	"github.com/desteves/realm/internal"
 	"github.com/desteves/realm/pkg/auth"
@@ -16,7 +17,7 @@ import (
 	"golang.org/x/net/context/ctxhttp"
 )
 
-//HealthCheck Query for Realm Config Verification
+// HealthCheck Query for Realm Config Verification
 type HealthCheck struct {
 	ID          string
 	Description string
@@ -24,33 +25,6 @@ type HealthCheck struct {
 	Endpoint    string
 }
 
-// PathSegment returned when the response had an error. Path segments that represent fields should be strings, and path segments that represent list indices should be 0‐indexed integers. If the error happens in an aliased field, the path to the error should use the aliased name, since it represents a path in the response, not in the query.
-type PathSegment struct {
-	parent *PathSegment
-	value  interface{}
-}
-
-func (p *PathSegment) toSlice() []interface{} {
-	if p == nil {
-		return nil
-	}
-	return append(p.parent.toSlice(), p.value)
-}
-
-// Location returned when the response had an error. Each location is a map with the keys line and column, both positive numbers starting from 1 which describe the beginning of an associated syntax element
-type Location struct {
-	Line   int `json:"line,omitempty"`
-	Column int `json:"column,omitempty"`
-}
-
-// Error is a GraphQL Error as per http://spec.graphql.org/June2018/#sec-Errors
-type Error struct {
-	Message    string                 `json:"message,omitempty"`
-	Path       PathSegment            `json:"path,omitempty"`
-	Locations  []Location             `json:"locations,omitempty"`
-	Extensions map[string]interface{} `json:"extensions,omitempty"`
-}
-
 // Variable is a GraphQL Variable passed in the Body of a GraphQL Request.
 type Variable map[string]interface{}
 
@@ -64,13 +38,18 @@ type Request struct {
 // Response is the payload for a GraphQL response.
 type Response struct {
 	Data   interface{} `json:"data,omitempty" graphql:"data,omitempty"`
-	Errors []Error     `json:"errors,omitempty"`
+	Errors Errors      `json:"errors,omitempty"`
 }
 
+// ErrNotConnected is returned by operations run before Connect or after Disconnect.
+var ErrNotConnected = auth.ErrNotConnected
+
 // Client is a Realm GraphQL Client with authentication to a Realm Application. The Realm GraphQL Server URI is stored in uri
 type Client struct {
-	client *auth.Client
-	uri    *string
+	client           *auth.Client
+	uri              *string
+	allowPartialData bool
+	reauthPolicy     string
 }
 
 // NewClient creates a new Client
@@ -93,13 +72,27 @@ func (c *Client) configure(opts *options.ClientOptions) error {
 	if err := opts.Validate(); err != nil {
 		return err
 	}
-	uri := "https://stitch.mongodb.com/api/client/v2.0/app/" + *opts.AppID + "/graphql"
+	uri := opts.AppURL() + "/graphql"
 	c.uri = &uri
+	c.allowPartialData = opts.AllowPartialData != nil && *opts.AllowPartialData
+	c.reauthPolicy = options.ReauthLogin
+	if opts.ProviderName() == "anon-user" {
+		// logging in again would create another anonymous user, without the data of this one.
+		c.reauthPolicy = options.ReauthRefresh
+	}
+	if opts.ReauthPolicy != nil {
+		c.reauthPolicy = *opts.ReauthPolicy
+	}
 	return nil
 }
 
-//Health needs to be implemented on the GraphQL Server as it looks for a very specific schema/document.
+// Health needs to be implemented on the GraphQL Server as it looks for a very specific schema/document.
 func (c *Client) Health(response *Response) error {
+	return c.HealthContext(context.Background(), response)
+}
+
+// HealthContext is Health with a context for the query.
+func (c *Client) HealthContext(ctx context.Context, response *Response) error {
 	var q struct {
 		Health struct {
 			ID          string `graphql:"_id"`
@@ -108,19 +101,63 @@ func (c *Client) Health(response *Response) error {
 			Endpoint    string `graphql:"endpoint"`
 		} `graphql:"health"`
 	}
-	return c.Query(context.TODO(), &q, nil, response)
+	return c.Query(ctx, &q, nil, response)
 }
 
 // Connect establishes Realm auth and creates a new graphql client
 func (c *Client) Connect() error {
-	err := c.client.Connect()
+	return c.ConnectContext(context.Background())
+}
+
+// ConnectContext is Connect with a context bounding the Realm login.
+func (c *Client) ConnectContext(ctx context.Context) error {
+	err := c.client.ConnectContext(ctx)
 	if err != nil {
 		return err
 	}
+	// the app may have been located on a regional host
+	uri := c.client.AppURL() + "/graphql"
+	c.uri = &uri
 	return nil
 }
 
-// Query wrapper
+// Auth returns the Realm auth client of c, e.g. to set its Store or Hooks before Connect.
+func (c *Client) Auth() *auth.Client {
+	return c.client
+}
+
+// Disconnect ends the Realm session, see auth.Client.Disconnect
+func (c *Client) Disconnect(ctx context.Context) error {
+	return c.client.Disconnect(ctx)
+}
+
+// ForUser returns a view of the client sending its requests as a user of the sessions, or auth.ErrNoSession.
+// The view keeps the options of c. It holds the current session of the user, so a new view is needed once the user logs in again.
+func (c *Client) ForUser(sessions *auth.Sessions, userID string) (*Client, error) {
+	a, err := sessions.Client(userID)
+	if err != nil {
+		return nil, err
+	}
+	return c.withAuth(a), nil
+}
+
+// ForActiveUser is ForUser for the active user of the sessions.
+func (c *Client) ForActiveUser(sessions *auth.Sessions) (*Client, error) {
+	a, err := sessions.Active()
+	if err != nil {
+		return nil, err
+	}
+	return c.withAuth(a), nil
+}
+
+func (c *Client) withAuth(a *auth.Client) *Client {
+	uri := a.AppURL() + "/graphql"
+	return &Client{client: a, uri: &uri, allowPartialData: c.allowPartialData, reauthPolicy: c.reauthPolicy}
+}
+
+// Query builds a query from the provided struct and runs it. When query is a
+// pointer to a struct, the response data is also decoded into it, matching
+// fields by their `graphql:"..."` tags.
 func (c *Client) Query(ctx context.Context, query interface{}, variables map[string]interface{}, response *Response) error {
 
 	if query == nil {
@@ -132,7 +169,7 @@ func (c *Client) Query(ctx context.Context, query interface{}, variables map[str
 		Variables: variables,
 	}
 
-	err := c.do(ctx, payload, response)
+	err := c.do(ctx, payload, query, response)
 	if err != nil {
 		return errors.Wrap(err, "q do")
 	}
@@ -140,13 +177,39 @@ func (c *Client) Query(ctx context.Context, query interface{}, variables map[str
 	return nil
 }
 
-// Mutate wrapper
-func (c *Client) Mutate(ctx context.Context, mutation string, variables map[string]interface{}, response *Response) error {
+// Mutate builds a mutation from the provided struct and runs it. When mutation
+// is a pointer to a struct, the response data is also decoded into it.
+// Variables are typed after their Go type name, e.g. a CustomerInsertInput
+// value is declared as $customer:CustomerInsertInput!
+// Mutations written as strings are sent with MutateRaw.
+func (c *Client) Mutate(ctx context.Context, mutation interface{}, variables map[string]interface{}, response *Response) error {
+
+	if mutation == nil {
+		return fmt.Errorf("mutation parameter cannot be nil")
+	}
+	if t := reflect.TypeOf(mutation); t.Kind() != reflect.Struct && !(t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct) {
+		return fmt.Errorf("mutation parameter must be a struct or a pointer to a struct, not %T, use MutateRaw for strings", mutation)
+	}
+
+	payload := Request{
+		Query:     internal.ConstructMutation(mutation, variables),
+		Variables: variables,
+	}
+	err := c.do(ctx, payload, mutation, response)
+	if err != nil {
+		return errors.Wrap(err, "m do")
+	}
+
+	return nil
+}
+
+// MutateRaw runs a mutation written as a GraphQL string.
+func (c *Client) MutateRaw(ctx context.Context, mutation string, variables map[string]interface{}, response *Response) error {
 	payload := Request{
 		Query:     mutation,
 		Variables: variables,
 	}
-	err := c.do(ctx, payload, response)
+	err := c.do(ctx, payload, nil, response)
 	if err != nil {
 		return errors.Wrap(err, "m do")
 	}
@@ -154,17 +217,55 @@ func (c *Client) Mutate(ctx context.Context, mutation string, variables map[stri
 	return nil
 }
 
+// rawResponse keeps the data undecoded so it can be stored both in Response and in the typed struct.
+type rawResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors Errors          `json:"errors"`
+}
+
 // do executes a single GraphQL operation.
-func (c *Client) do(ctx context.Context, payload interface{}, response *Response) error {
+// If v is a non-nil pointer, the response data is decoded into it.
+func (c *Client) do(ctx context.Context, payload interface{}, v interface{}, response *Response) error {
 	if response == nil {
 		return fmt.Errorf("*Response parameter cannot be nil")
 	}
+	hc := c.client.SessionClient()
+	if hc == nil {
+		return ErrNotConnected
+	}
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(payload)
 	if err != nil {
 		return err
 	}
-	resp, err := ctxhttp.Post(ctx, c.client.HTTPClient, *c.uri, "application/json", &buf)
+	body := buf.Bytes()
+	// the access token sent, so concurrent requests rejected for it re-authenticate once.
+	var sent string
+	if t := c.client.CurrentToken(); t != nil {
+		sent = t.AccessToken
+	}
+	resp, err := ctxhttp.Post(ctx, hc, *c.uri, "application/json", bytes.NewReader(body))
+	if rejected(resp, err) {
+		uerr := unauthorized(resp, err)
+		if c.reauthPolicy == options.ReauthNone {
+			return uerr
+		}
+		// the refresh of an expired access token was sent with the request, it is not sent again.
+		refreshed := errors.Is(err, auth.ErrRefreshRejected)
+		err = c.client.Reauthenticate(ctx, sent, refreshed, c.reauthPolicy == options.ReauthLogin)
+		if err != nil {
+			return &UnauthorizedError{Err: err}
+		}
+		hc = c.client.SessionClient()
+		if hc == nil {
+			return ErrNotConnected
+		}
+		// the request is replayed once, a second rejection is final.
+		resp, err = ctxhttp.Post(ctx, hc, *c.uri, "application/json", bytes.NewReader(body))
+		if rejected(resp, err) {
+			return unauthorized(resp, err)
+		}
+	}
 	if err != nil {
 		return err
 	}
@@ -173,5 +274,46 @@ func (c *Client) do(ctx context.Context, payload interface{}, response *Response
 		body, _ := ioutil.ReadAll(resp.Body)
 		return fmt.Errorf("non-200 OK status code: %v body: %q", resp.Status, body)
 	}
-	return json.NewDecoder(resp.Body).Decode(&response)
+	var raw rawResponse
+	err = json.NewDecoder(resp.Body).Decode(&raw)
+	if err != nil {
+		return err
+	}
+	response.Errors = raw.Errors
+	response.Data = nil
+	if len(raw.Data) > 0 {
+		err = json.Unmarshal(raw.Data, &response.Data)
+		if err != nil {
+			return err
+		}
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		err = internal.UnmarshalGraphQL(raw.Data, v)
+		if err != nil {
+			return err
+		}
+	}
+	if len(raw.Errors) > 0 && !(c.allowPartialData && response.Data != nil) {
+		return raw.Errors
+	}
+	return nil
+}
+
+// rejected reports whether the request was rejected for its access token: the server answered 401 Unauthorized,
+// or the expired access token could not be refreshed.
+func rejected(resp *http.Response, err error) bool {
+	if err != nil {
+		return errors.Is(err, auth.ErrRefreshRejected)
+	}
+	return resp.StatusCode == http.StatusUnauthorized
+}
+
+// unauthorized returns the error of a rejected request, closing the response if any.
+func unauthorized(resp *http.Response, err error) *UnauthorizedError {
+	if resp == nil {
+		return &UnauthorizedError{Err: err}
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return &UnauthorizedError{Body: body}
 }
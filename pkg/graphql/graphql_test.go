@@ -2,10 +2,16 @@ package graphql
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/desteves/realm/pkg/auth"
 	"github.com/desteves/realm/pkg/options"
 )
 
@@ -37,6 +43,58 @@ var _ = Describe("Graphql", func() {
 			})
 		})
 	})
+	Describe("Connect", func() {
+		Context("against a stub server", func() {
+			var server *httptest.Server
+			BeforeEach(func() {
+				server = newRealmServer(nil)
+			})
+			AfterEach(func() {
+				server.Close()
+			})
+			It("should use the discovered app location", func() {
+				opts := testOptions(server)
+				discover := true
+				opts.DiscoverLocation = &discover
+				nc := connect(opts)
+				Expect(*nc.uri).Should(Equal(server.URL + "/api/client/v2.0/app/graphqlserver-lrnqt/graphql"))
+
+				var q struct{ Name string }
+				var response Response
+				Expect(nc.Query(context.TODO(), &q, nil, &response)).Should(Succeed())
+				Expect(q.Name).Should(Equal("diana"))
+			})
+		})
+	})
+	Describe("Auth", func() {
+		var server *httptest.Server
+		var logins int32
+		BeforeEach(func() {
+			atomic.StoreInt32(&logins, 0)
+			server = newRealmServer(realmHandlers{
+				appPath("/auth/providers/anon-user/login"): func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&logins, 1)
+					w.Write([]byte(`{"access_token":"access","refresh_token":"refresh","user_id":"5eb1"}`))
+				},
+			})
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("should resume the session of the store", func() {
+			store := auth.NewMemoryTokenStore()
+			for i := 0; i < 2; i++ {
+				nc, err := NewClient(testOptions(server))
+				Expect(err).ShouldNot(HaveOccurred())
+				nc.Auth().Store = store
+				Expect(nc.Connect()).Should(Succeed())
+				var q struct{ Name string }
+				var response Response
+				Expect(nc.Query(context.TODO(), &q, nil, &response)).Should(Succeed())
+			}
+			Expect(atomic.LoadInt32(&logins)).Should(Equal(int32(1)))
+		})
+	})
 	Describe("Health", func() {
 		Context("with valid client options", func() {
 			var opts options.ClientOptions
@@ -133,7 +191,190 @@ var _ = Describe("Graphql", func() {
 
 		})
 	})
-	Describe("Mutate", func() {
+	Describe("Query", func() {
+		Context("against a stub server", func() {
+			var server *httptest.Server
+			var nc *Client
+			BeforeEach(func() {
+				server = newRealmServer(realmHandlers{
+					appPath("/graphql"): func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.Write([]byte(`{"data":{"listingsAndReviewss":[{"_id":"1","name":"one"},{"_id":"2","name":"two"}]}}`))
+					},
+				})
+				nc = connect(testOptions(server))
+			})
+			AfterEach(func() {
+				server.Close()
+			})
+			It("should decode the data into the query struct", func() {
+				var q struct {
+					Reviews []struct {
+						ID   string `graphql:"_id"`
+						Name string `graphql:"name"`
+					} `graphql:"listingsAndReviewss( limit: 3 )"`
+				}
+				var response Response
+				err := nc.Query(context.TODO(), &q, nil, &response)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(q.Reviews).Should(HaveLen(2))
+				Expect(q.Reviews[1].Name).Should(Equal("two"))
+				Expect(response.Data).ShouldNot(BeNil())
+			})
+		})
+	})
+	Describe("Errors", func() {
+		Context("against a stub server", func() {
+			var server *httptest.Server
+			var nc *Client
+			var opts *options.ClientOptions
+			var payload string
+			BeforeEach(func() {
+				server = newRealmServer(realmHandlers{
+					appPath("/graphql"): func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.Write([]byte(payload))
+					},
+				})
+				opts = testOptions(server)
+			})
+			JustBeforeEach(func() {
+				nc = connect(opts)
+			})
+			AfterEach(func() {
+				server.Close()
+			})
+			Context("when the response has errors and no data", func() {
+				BeforeEach(func() {
+					payload = `{"data":null,"errors":[{"message":"no matching document","locations":[{"line":1,"column":2}]},{"message":"rate limited"}]}`
+				})
+				It("should return them as Errors", func() {
+					var response Response
+					err := nc.Query(context.TODO(), &struct{ Name string }{}, nil, &response)
+					Expect(err).Should(HaveOccurred())
+
+					var gqlErrs Errors
+					Expect(errors.As(err, &gqlErrs)).Should(BeTrue())
+					Expect(gqlErrs).Should(HaveLen(2))
+					Expect(gqlErrs[0].Locations).Should(Equal([]Location{{Line: 1, Column: 2}}))
+					Expect(response.Errors).Should(Equal(gqlErrs))
+
+					var first *Error
+					Expect(errors.As(err, &first)).Should(BeTrue())
+					Expect(first.Message).Should(Equal("no matching document"))
+					Expect(errors.Is(err, Error{Message: "rate limited"})).Should(BeTrue())
+					Expect(errors.Is(err, Error{Message: "other"})).Should(BeFalse())
+				})
+			})
+			Context("when the errors have a path", func() {
+				BeforeEach(func() {
+					payload = `{"data":{"hero":[{"name":null}]},"errors":[{"message":"Name for character with ID 1002 could not be fetched.","path":["hero",0,"name"]}]}`
+				})
+				It("should decode and render the path", func() {
+					var response Response
+					err := nc.Query(context.TODO(), &struct{ Name string }{}, nil, &response)
+					Expect(err).Should(HaveOccurred())
+					Expect(response.Errors).Should(HaveLen(1))
+					Expect(response.Errors[0].Path.Segments()).Should(Equal([]interface{}{"hero", 0, "name"}))
+					Expect(err.Error()).Should(ContainSubstring("path hero[0].name"))
+				})
+			})
+			Context("when the response has partial data", func() {
+				BeforeEach(func() {
+					payload = `{"data":{"name":"diana"},"errors":[{"message":"cannot read email"}]}`
+				})
+				It("should error by default", func() {
+					var response Response
+					err := nc.Query(context.TODO(), &struct{ Name string }{}, nil, &response)
+					Expect(err).Should(HaveOccurred())
+				})
+				Context("and partial data is allowed", func() {
+					BeforeEach(func() {
+						allow := true
+						opts.AllowPartialData = &allow
+					})
+					It("should succeed and keep the errors", func() {
+						var q struct{ Name string }
+						var response Response
+						err := nc.Query(context.TODO(), &q, nil, &response)
+						Expect(err).ShouldNot(HaveOccurred())
+						Expect(q.Name).Should(Equal("diana"))
+						Expect(response.Errors).Should(HaveLen(1))
+					})
+				})
+			})
+		})
+	})
+	Describe("PathSegment", func() {
+		It("should round trip through JSON", func() {
+			var p PathSegment
+			err := json.Unmarshal([]byte(`["hero", 1, "friends", 0, "name"]`), &p)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(p.String()).Should(Equal("hero[1].friends[0].name"))
 
+			b, err := json.Marshal(&p)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(b).Should(MatchJSON(`["hero", 1, "friends", 0, "name"]`))
+		})
+		It("should reject other segment types", func() {
+			var p PathSegment
+			Expect(json.Unmarshal([]byte(`["hero", 1.5]`), &p)).ShouldNot(Succeed())
+			Expect(json.Unmarshal([]byte(`["hero", true]`), &p)).ShouldNot(Succeed())
+		})
+		It("should render an empty path", func() {
+			var p *PathSegment
+			Expect(p.String()).Should(BeEmpty())
+			Expect(json.Unmarshal([]byte(`[]`), &PathSegment{})).Should(Succeed())
+		})
+	})
+	Describe("Mutate", func() {
+		Context("against a stub server", func() {
+			var server *httptest.Server
+			var nc *Client
+			var body Request
+			BeforeEach(func() {
+				body = Request{}
+				server = newRealmServer(realmHandlers{
+					appPath("/graphql"): func(w http.ResponseWriter, r *http.Request) {
+						json.NewDecoder(r.Body).Decode(&body)
+						w.Header().Set("Content-Type", "application/json")
+						w.Write([]byte(`{"data":{"insertOneCustomer":{"_id":"5ebd"}}}`))
+					},
+				})
+				nc = connect(testOptions(server))
+			})
+			AfterEach(func() {
+				server.Close()
+			})
+			It("should send the mutation and decode the result", func() {
+				type CustomerInsertInput struct {
+					Name string `json:"name"`
+				}
+				var m struct {
+					InsertOneCustomer struct {
+						ID string `graphql:"_id"`
+					} `graphql:"insertOneCustomer(data:$customer)"`
+				}
+				var response Response
+				err := nc.Mutate(context.TODO(), &m, Variable{"customer": CustomerInsertInput{Name: "diana"}}, &response)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(body.Query).Should(Equal(`mutation($customer:CustomerInsertInput!){insertOneCustomer(data:$customer){_id}}`))
+				Expect(body.Variables).Should(HaveKeyWithValue("customer", HaveKeyWithValue("name", "diana")))
+				Expect(m.InsertOneCustomer.ID).Should(Equal("5ebd"))
+			})
+			It("should reject mutations which are not structs", func() {
+				var response Response
+				err := nc.Mutate(context.TODO(), `mutation { insertOneCustomer(data: {name: "diana"}) { _id } }`, nil, &response)
+				Expect(err).Should(MatchError(ContainSubstring("use MutateRaw")))
+				Expect(body.Query).Should(BeEmpty())
+			})
+			It("should send raw mutations verbatim", func() {
+				mutation := `mutation { insertOneCustomer(data: {name: "diana"}) { _id } }`
+				var response Response
+				err := nc.MutateRaw(context.TODO(), mutation, nil, &response)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(body.Query).Should(Equal(mutation))
+			})
+		})
 	})
 })
@@ -0,0 +1,82 @@
+package graphql
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/desteves/realm/pkg/options"
+)
+
+// testAppID is the app served by the stub Realm server.
+const testAppID = "graphqlserver-lrnqt"
+
+// clientPath returns the path of a client API endpoint, e.g. clientPath("/auth/session").
+func clientPath(p string) string {
+	return options.ClientAPIPath + p
+}
+
+// appPath returns the path of an endpoint of the test app, e.g. appPath("/graphql").
+func appPath(p string) string {
+	return clientPath("/app/" + testAppID + p)
+}
+
+// realmHandlers are handlers of the stub Realm server by path, see newRealmServer.
+type realmHandlers map[string]http.HandlerFunc
+
+// newRealmServer starts a stub of the Realm client API for testAppID. By default it reports itself as the
+// regional host of the app, logs anonymous users in as 5eb1 with the access token "access", refreshes
+// sessions to the same token and answers GraphQL requests bearing it with data. handlers replace the
+// defaults or add endpoints, keyed by path.
+func newRealmServer(handlers realmHandlers) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defaults := realmHandlers{
+		appPath("/location"): func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"deployment_model":"LOCAL","location":"US-VA","hostname":"` + server.URL + `"}`))
+		},
+		appPath("/auth/providers/anon-user/login"): func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"access_token":"access","refresh_token":"refresh","user_id":"5eb1","device_id":"5eb2"}`))
+		},
+		clientPath("/auth/session"): func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case "POST":
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"access_token":"access"}`))
+			case "DELETE":
+				w.WriteHeader(http.StatusNoContent)
+			}
+		},
+		appPath("/graphql"): func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer access" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"data":{"name":"diana"}}`))
+		},
+	}
+	for path, h := range defaults {
+		if _, ok := handlers[path]; !ok {
+			mux.HandleFunc(path, h)
+		}
+	}
+	for path, h := range handlers {
+		mux.HandleFunc(path, h)
+	}
+	return server
+}
+
+// testOptions returns options logging in anonymously to testAppID on the stub server.
+func testOptions(server *httptest.Server) *options.ClientOptions {
+	appid, provider := testAppID, "anon-user"
+	return &options.ClientOptions{AppID: &appid, AuthMechanism: &provider, BaseURL: &server.URL}
+}
+
+// connect returns a client logged in with the options.
+func connect(opts *options.ClientOptions) *Client {
+	nc, err := NewClient(opts)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(nc.Connect()).Should(Succeed())
+	return nc
+}
@@ -0,0 +1,179 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/oauth2"
+
+	"github.com/desteves/realm/pkg/auth"
+	"github.com/desteves/realm/pkg/options"
+)
+
+var _ = Describe("Reauthentication", func() {
+	var server *httptest.Server
+	var opts *options.ClientOptions
+	var refreshes, logins, queries int32
+	var refreshFails, alwaysUnauthorized bool
+	BeforeEach(func() {
+		atomic.StoreInt32(&refreshes, 0)
+		atomic.StoreInt32(&logins, 0)
+		atomic.StoreInt32(&queries, 0)
+		refreshFails, alwaysUnauthorized = false, false
+		server = newRealmServer(realmHandlers{
+			appPath("/auth/providers/anon-user/login"): func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&logins, 1)
+				w.Write([]byte(`{"access_token":"access","refresh_token":"refresh","user_id":"5eb1"}`))
+			},
+			clientPath("/auth/session"): func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&refreshes, 1)
+				if refreshFails {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"access_token":"access"}`))
+			},
+			appPath("/graphql"): func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&queries, 1)
+				if alwaysUnauthorized || r.Header.Get("Authorization") != "Bearer access" {
+					w.WriteHeader(http.StatusUnauthorized)
+					w.Write([]byte(`{"error":"invalid session"}`))
+					return
+				}
+				w.Write([]byte(`{"data":{"name":"diana"}}`))
+			},
+		})
+		opts = testOptions(server)
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	// run queries with the client, returning the error if any.
+	run := func(nc *Client) error {
+		var q struct {
+			Name string
+		}
+		var response Response
+		err := nc.Query(context.TODO(), &q, nil, &response)
+		if err == nil {
+			Expect(q.Name).Should(Equal("diana"))
+		}
+		return err
+	}
+	// connect connects with an access token the server rejects although it has not expired.
+	connect := func() *Client {
+		nc, err := NewClient(opts)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(nc.client.ConnectWithToken(&oauth2.Token{AccessToken: "revoked", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)})).Should(Succeed())
+		return nc
+	}
+	query := func() error {
+		return run(connect())
+	}
+	relogin := func() {
+		policy := options.ReauthLogin
+		opts.ReauthPolicy = &policy
+	}
+	It("should refresh the token and replay the request", func() {
+		Expect(query()).Should(Succeed())
+		Expect(atomic.LoadInt32(&refreshes)).Should(Equal(int32(1)))
+		Expect(atomic.LoadInt32(&logins)).Should(Equal(int32(0)))
+		Expect(atomic.LoadInt32(&queries)).Should(Equal(int32(2)))
+	})
+	It("should log in again when the refresh fails", func() {
+		relogin()
+		refreshFails = true
+		Expect(query()).Should(Succeed())
+		Expect(atomic.LoadInt32(&refreshes)).Should(Equal(int32(1)))
+		Expect(atomic.LoadInt32(&logins)).Should(Equal(int32(1)))
+	})
+	It("should log in again when the expired access token cannot be refreshed", func() {
+		relogin()
+		refreshFails = true
+		nc, err := NewClient(opts)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(nc.client.ConnectWithToken(&oauth2.Token{AccessToken: "expired", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)})).Should(Succeed())
+		Expect(run(nc)).Should(Succeed())
+		Expect(atomic.LoadInt32(&refreshes)).Should(Equal(int32(1)))
+		Expect(atomic.LoadInt32(&logins)).Should(Equal(int32(1)))
+		Expect(atomic.LoadInt32(&queries)).Should(Equal(int32(1)))
+	})
+	It("should not log in anonymous users again by default", func() {
+		refreshFails = true
+		err := query()
+		Expect(errors.Is(err, ErrUnauthorized)).Should(BeTrue())
+		Expect(errors.Is(err, auth.ErrRefreshRejected)).Should(BeTrue())
+		Expect(atomic.LoadInt32(&logins)).Should(Equal(int32(0)))
+	})
+	It("should re-authenticate concurrent requests once", func() {
+		relogin()
+		refreshFails = true
+		nc := connect()
+		errs := make(chan error, 8)
+		for i := 0; i < cap(errs); i++ {
+			go func() {
+				defer GinkgoRecover()
+				errs <- run(nc)
+			}()
+		}
+		for i := 0; i < cap(errs); i++ {
+			Expect(<-errs).ShouldNot(HaveOccurred())
+		}
+		Expect(atomic.LoadInt32(&refreshes)).Should(Equal(int32(1)))
+		Expect(atomic.LoadInt32(&logins)).Should(Equal(int32(1)))
+	})
+	It("should report the new login to the hooks of the auth client", func() {
+		relogin()
+		refreshFails = true
+		nc, err := NewClient(opts)
+		Expect(err).ShouldNot(HaveOccurred())
+		var events []string
+		nc.Auth().Hooks = auth.Hooks{
+			OnLogin:        func(t *oauth2.Token, userID string) { events = append(events, "login "+userID) },
+			OnRefresh:      func(t *oauth2.Token, userID string) { events = append(events, "refresh "+userID) },
+			OnRefreshError: func(err error, userID string) { events = append(events, "refresh error "+userID) },
+		}
+		Expect(nc.Auth().ConnectWithToken((&oauth2.Token{AccessToken: "revoked", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}).
+			WithExtra(map[string]interface{}{"user_id": "5eb1"}))).Should(Succeed())
+		var q struct {
+			Name string
+		}
+		var response Response
+		Expect(nc.Query(context.TODO(), &q, nil, &response)).Should(Succeed())
+		Expect(events).Should(Equal([]string{"refresh error 5eb1", "login 5eb1"}))
+	})
+	It("should not log in again with the refresh policy", func() {
+		refreshFails = true
+		policy := options.ReauthRefresh
+		opts.ReauthPolicy = &policy
+		err := query()
+		Expect(errors.Is(err, ErrUnauthorized)).Should(BeTrue())
+		var uerr *UnauthorizedError
+		Expect(errors.As(err, &uerr)).Should(BeTrue())
+		Expect(uerr.Err).Should(HaveOccurred())
+		Expect(atomic.LoadInt32(&logins)).Should(Equal(int32(0)))
+	})
+	It("should not re-authenticate with the none policy", func() {
+		policy := options.ReauthNone
+		opts.ReauthPolicy = &policy
+		Expect(errors.Is(query(), ErrUnauthorized)).Should(BeTrue())
+		Expect(atomic.LoadInt32(&refreshes)).Should(Equal(int32(0)))
+		Expect(atomic.LoadInt32(&queries)).Should(Equal(int32(1)))
+	})
+	It("should replay the request only once", func() {
+		alwaysUnauthorized = true
+		err := query()
+		Expect(errors.Is(err, ErrUnauthorized)).Should(BeTrue())
+		var uerr *UnauthorizedError
+		Expect(errors.As(err, &uerr)).Should(BeTrue())
+		Expect(uerr.Body).Should(MatchJSON(`{"error":"invalid session"}`))
+		Expect(atomic.LoadInt32(&queries)).Should(Equal(int32(2)))
+	})
+})
@@ -0,0 +1,62 @@
+package options
+
+import (
+	"errors"
+	"strings"
+)
+
+// Sentinel errors wrapped by the FieldError values of a ValidationError, usable with errors.Is.
+var (
+	ErrMissingAppID            = errors.New("AppID is required, but missing")
+	ErrMissingProvider         = errors.New("Auth Provider is required, but missing")
+	ErrUnsupportedProvider     = errors.New("Auth Provider is not supported")
+	ErrMissingCredential       = errors.New("credential field is required by the provider, but missing")
+	ErrUnexpectedCredential    = errors.New("credential field is not used by the provider")
+	ErrInvalidURL              = errors.New("must be an absolute url")
+	ErrUnsupportedReauthPolicy = errors.New("reauthentication policy is not supported")
+)
+
+// FieldError describes a single invalid field of the ClientOptions.
+type FieldError struct {
+	Field    string // e.g. Credential.Password
+	Err      error  // one of the Err* sentinels
+	Expected string // the expected shape, e.g. local-userpass expects Credential{Username, Password}
+}
+
+// Error implements the error interface.
+func (e *FieldError) Error() string {
+	msg := e.Field + ": " + e.Err.Error()
+	if e.Expected != "" {
+		msg += " (" + e.Expected + ")"
+	}
+	return msg
+}
+
+// Unwrap returns the sentinel error.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError lists every problem found by ClientOptions.Validate.
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return "invalid client options: " + strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the field errors matches target.
+func (e *ValidationError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
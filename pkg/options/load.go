@@ -0,0 +1,199 @@
+package options
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// LoadFile reads client options from a YAML (.yaml, .yml) or JSON (.json) file, using the
+// yaml and json tags of ClientOptions.
+func LoadFile(path string) (*ClientOptions, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	opts := &ClientOptions{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, opts)
+	case ".json":
+		err = json.Unmarshal(b, opts)
+	default:
+		return nil, fmt.Errorf("unsupported options file extension %q, use .yaml, .yml or .json", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read options from %s: %v", path, err)
+	}
+	if opts.Credential != nil {
+		opts.Credential.Payload = jsonCompatible(opts.Credential.Payload)
+	}
+	return opts, nil
+}
+
+// WriteFile writes client options to a YAML (.yaml, .yml) or JSON (.json) file LoadFile reads back.
+// Unlike json.Marshal, the plaintext secrets of the Credential are kept, so the file is only readable by its owner.
+func WriteFile(path string, opts *ClientOptions) error {
+	var b []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		b, err = yaml.Marshal(opts)
+	case ".json":
+		type credential Credential // drops MarshalJSON, which redacts the secrets
+		b, err = json.MarshalIndent(struct {
+			*ClientOptions
+			Credential *credential `json:"credential,omitempty"`
+		}{opts, (*credential)(opts.Credential)}, "", "  ")
+	default:
+		return fmt.Errorf("unsupported options file extension %q, use .yaml, .yml or .json", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write options to %s: %v", path, err)
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+// FromEnv reads client options from environment variables named after the prefix and the env tags
+// of the fields, e.g. with prefix REALM: REALM_APP_ID, REALM_PROVIDER, REALM_USERNAME, REALM_PASSWORD,
+// REALM_KEY, REALM_TOKEN, REALM_BASE_URL, REALM_WEBHOOK_BASE_URL, REALM_DISCOVER_LOCATION,
+// REALM_ALLOW_PARTIAL_DATA and REALM_REAUTH_POLICY. Unset variables leave their option nil,
+// and the Credential stays nil without any credential variable.
+func FromEnv(prefix string) (*ClientOptions, error) {
+	if prefix != "" {
+		prefix = strings.TrimSuffix(prefix, "_") + "_"
+	}
+	opts := &ClientOptions{}
+	_, err := readEnv(prefix, reflect.ValueOf(opts).Elem())
+	if err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// readEnv sets the fields of the struct v from the variables named after their env tag,
+// recursing into struct pointers with an empty tag. It reports whether any variable was set.
+func readEnv(prefix string, v reflect.Value) (bool, error) {
+	found := false
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		name, ok := f.Tag.Lookup("env")
+		if !ok || name == "-" {
+			continue
+		}
+		var value interface{}
+		switch f.Type {
+		case reflect.TypeOf((*string)(nil)):
+			if s := lookupEnv(prefix + name); s != nil {
+				value = s
+			}
+		case reflect.TypeOf((*bool)(nil)):
+			b, err := lookupEnvBool(prefix + name)
+			if err != nil {
+				return false, err
+			}
+			if b != nil {
+				value = b
+			}
+		default:
+			if name != "" || f.Type.Kind() != reflect.Ptr || f.Type.Elem().Kind() != reflect.Struct {
+				return false, fmt.Errorf("cannot read %s of type %s from the environment", f.Name, f.Type)
+			}
+			nested := reflect.New(f.Type.Elem())
+			set, err := readEnv(prefix, nested.Elem())
+			if err != nil {
+				return false, err
+			}
+			if set {
+				value = nested.Interface()
+			}
+		}
+		if value != nil {
+			v.Field(i).Set(reflect.ValueOf(value))
+			found = true
+		}
+	}
+	return found, nil
+}
+
+func lookupEnv(name string) *string {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+func lookupEnvBool(name string) (*bool, error) {
+	v := lookupEnv(name)
+	if v == nil {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(*v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a boolean, got %q", name, *v)
+	}
+	return &b, nil
+}
+
+// MergeClientOptions combines the given options into a single one. Options are applied in order,
+// a non-nil field overriding the previous ones, so for file < env < explicit precedence use
+//
+//	MergeClientOptions(fromFile, fromEnv, explicit)
+//
+// Credential fields are merged one by one, nil options are skipped.
+func MergeClientOptions(opts ...*ClientOptions) *ClientOptions {
+	merged := &ClientOptions{}
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		mergeFields(reflect.ValueOf(merged).Elem(), reflect.ValueOf(o).Elem())
+	}
+	return merged
+}
+
+// mergeFields sets the fields of dst to the non-nil fields of src, both structs of the same type.
+// A *Credential is merged field by field into a copy, so the merged options do not alias it.
+func mergeFields(dst, src reflect.Value) {
+	for i := 0; i < src.NumField(); i++ {
+		sf := src.Field(i)
+		if sf.IsNil() {
+			continue
+		}
+		if sf.Type() == reflect.TypeOf((*Credential)(nil)) {
+			merged := &Credential{}
+			if df := dst.Field(i); !df.IsNil() {
+				*merged = *df.Interface().(*Credential)
+			}
+			mergeFields(reflect.ValueOf(merged).Elem(), sf.Elem())
+			sf = reflect.ValueOf(merged)
+		}
+		dst.Field(i).Set(sf)
+	}
+}
+
+// jsonCompatible converts the map[interface{}]interface{} values decoded by yaml into
+// map[string]interface{}, so they can be marshalled to JSON.
+func jsonCompatible(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = jsonCompatible(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range t {
+			t[i] = jsonCompatible(e)
+		}
+	}
+	return v
+}
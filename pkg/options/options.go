@@ -1,57 +1,183 @@
 // Package options contains shared properties/helpers to be consumed by other packages.
 package options
 
-import "fmt"
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultBaseURL is the Realm host used when no BaseURL is set.
+	DefaultBaseURL = "https://stitch.mongodb.com"
+	// RealmBaseURL is the host which replaced stitch.mongodb.com.
+	RealmBaseURL = "https://realm.mongodb.com"
+	// DefaultWebhookBaseURL is the webhook host used when no WebhookBaseURL is set.
+	DefaultWebhookBaseURL = "https://webhooks.mongodb-stitch.com"
+	// RealmWebhookBaseURL is the webhook host which replaced webhooks.mongodb-stitch.com.
+	RealmWebhookBaseURL = "https://webhooks.mongodb-realm.com"
+	// ClientAPIPath is the path of the client API under the base URL.
+	ClientAPIPath = "/api/client/v2.0"
+)
+
+// Policies to re-authenticate after the GraphQL server answered 401 Unauthorized or the access token could not be
+// refreshed, see ClientOptions.ReauthPolicy.
+const (
+	// ReauthNone returns the error right away.
+	ReauthNone = "none"
+	// ReauthRefresh refreshes the access token and replays the request once.
+	ReauthRefresh = "refresh"
+	// ReauthLogin refreshes the access token, logs in again with the Credential if the refresh fails,
+	// and replays the request once. It is the default, except for anon-user.
+	ReauthLogin = "login"
+)
 
 // ClientOptions to connect to Realm
 type ClientOptions struct {
-	AppID         *string     `yaml:"appid" json:"app_id,omitempty"`
-	AuthMechanism *string     `yaml:"provider" json:"provider,omitempty"`
-	Credential    *Credential `yaml:"credential,omitempty" json:"credential,omitempty"`
+	AppID         *string     `yaml:"appid" json:"app_id,omitempty" env:"APP_ID"`
+	AuthMechanism *string     `yaml:"provider" json:"provider,omitempty" env:"PROVIDER"`
+	Credential    *Credential `yaml:"credential,omitempty" json:"credential,omitempty" env:""` // fields read with their own env tags
+	// BaseURL is the scheme and host all auth and GraphQL endpoints are derived from, defaults to DefaultBaseURL.
+	// Set it to a regional host for apps with a local deployment model, or to a fake server in tests.
+	BaseURL *string `yaml:"baseurl,omitempty" json:"base_url,omitempty" env:"BASE_URL"`
+	// WebhookBaseURL is the scheme and host of incoming webhooks, defaults to DefaultWebhookBaseURL.
+	WebhookBaseURL *string `yaml:"webhookbaseurl,omitempty" json:"webhook_base_url,omitempty" env:"WEBHOOK_BASE_URL"`
+	// DiscoverLocation makes Connect ask Realm for the app hostname and use it instead of BaseURL.
+	DiscoverLocation *bool `yaml:"discoverlocation,omitempty" json:"discover_location,omitempty" env:"DISCOVER_LOCATION"`
+	// HTTPClient is used for all Realm traffic: login, token refresh, Ping and GraphQL, defaults to http.DefaultClient.
+	// Set it for timeouts, proxies, custom TLS roots or test transports.
+	HTTPClient *http.Client `yaml:"-" json:"-" env:"-"`
+	// AllowPartialData makes GraphQL operations succeed when the response carries both data and errors.
+	// The errors are still available in the Response.
+	AllowPartialData *bool `yaml:"allowpartialdata,omitempty" json:"allow_partial_data,omitempty" env:"ALLOW_PARTIAL_DATA"`
+	// ReauthPolicy is what GraphQL operations do when the server answers 401 Unauthorized, e.g. once the
+	// refresh token was revoked: one of ReauthNone, ReauthRefresh or ReauthLogin, defaults to ReauthLogin,
+	// or to ReauthRefresh for anon-user since a new login is a new anonymous user.
+	ReauthPolicy *string `yaml:"reauthpolicy,omitempty" json:"reauth_policy,omitempty" env:"REAUTH_POLICY"`
+	// Logger receives the warnings of the client, e.g. about deprecated options. Nothing is logged when it is nil.
+	Logger logrus.FieldLogger `yaml:"-" json:"-" env:"-"`
 }
 
 // Credential are provider-agnostic, fill only needed or omit if using anonymous authentication
 type Credential struct {
-	Username *string `json:"username,omitempty" yaml:"username,omitempty"`
-	Password *string `json:"password,omitempty" yaml:"password,omitempty"`
-	Key      *string `json:"key,omitempty" yaml:"key,omitempty"`
-	Token    *string `json:"token,omitempty" yaml:"token,omitempty"`
+	Username *string `json:"username,omitempty" yaml:"username,omitempty" env:"USERNAME"`
+	Password *string `json:"password,omitempty" yaml:"password,omitempty" env:"PASSWORD"`
+	Key      *string `json:"key,omitempty" yaml:"key,omitempty" env:"KEY"`
+	Token    *string `json:"token,omitempty" yaml:"token,omitempty" env:"TOKEN"`
+	// Payload is posted verbatim at login by the custom-function provider, e.g. a map or a struct with json tags.
+	Payload interface{} `json:"payload,omitempty" yaml:"payload,omitempty" env:"-"`
+}
+
+// ServerAPIKey returns a credential for the api-key provider from a server API key. Server keys are
+// created by an app admin in the Realm UI or CLI and are meant for trusted backends.
+func ServerAPIKey(key string) *Credential {
+	return &Credential{Key: &key}
+}
+
+// UserAPIKey is an alias of ServerAPIKey for user API keys. User keys are created by a logged in user
+// for their own devices and log in as that user. Realm accepts both kinds with the same payload, so
+// the credentials are identical and the kind of key is not recorded.
+func UserAPIKey(key string) *Credential {
+	return ServerAPIKey(key)
+}
+
+// FunctionCredential returns a credential for the custom-function provider, posting payload at login.
+func FunctionCredential(payload interface{}) *Credential {
+	return &Credential{Payload: payload}
+}
+
+// ClientAPIURL returns the root of the client API, e.g. https://stitch.mongodb.com/api/client/v2.0
+func (c *ClientOptions) ClientAPIURL() string {
+	return baseURL(c.BaseURL, DefaultBaseURL) + ClientAPIPath
+}
+
+// AppURL returns the root of the app endpoints, e.g. https://stitch.mongodb.com/api/client/v2.0/app/<appid>
+func (c *ClientOptions) AppURL() string {
+	return c.ClientAPIURL() + "/app/" + appID(c.AppID)
+}
+
+// WebhookAppURL returns the root of the app incoming webhooks, e.g. https://webhooks.mongodb-stitch.com/api/client/v2.0/app/<appid>
+func (c *ClientOptions) WebhookAppURL() string {
+	return baseURL(c.WebhookBaseURL, DefaultWebhookBaseURL) + ClientAPIPath + "/app/" + appID(c.AppID)
+}
+
+func baseURL(u *string, def string) string {
+	if u == nil || *u == "" {
+		return def
+	}
+	return strings.TrimRight(*u, "/")
+}
+
+func appID(id *string) string {
+	if id == nil {
+		return ""
+	}
+	return *id
+}
+
+// legacyAPIKeyProvider is the former name of the api-key provider.
+const legacyAPIKeyProvider = "key"
+
+// ProviderName returns the provider logged in with: AuthMechanism, with the deprecated key provider
+// read as api-key. AuthMechanism itself is left as set.
+func (c *ClientOptions) ProviderName() string {
+	if c.AuthMechanism == nil {
+		return ""
+	}
+	if *c.AuthMechanism == legacyAPIKeyProvider {
+		return "api-key"
+	}
+	return *c.AuthMechanism
 }
 
-// Validate validates the client options. This method will return the first error found.
+// Deprecations returns a warning for each deprecated setting of the options, e.g. the key provider.
+func (c *ClientOptions) Deprecations() []string {
+	var warnings []string
+	if c.AuthMechanism != nil && *c.AuthMechanism == legacyAPIKeyProvider {
+		warnings = append(warnings, fmt.Sprintf("the %q provider is deprecated and will be removed, use %q instead", legacyAPIKeyProvider, "api-key"))
+	}
+	return warnings
+}
+
+// Validate validates the client options. All the problems found are reported together in a *ValidationError.
+// The options are not modified: the deprecated key provider is validated as api-key, see Deprecations,
+// and the credential is ignored for anon-user.
 func (c *ClientOptions) Validate() error {
+	var errs []*FieldError
 
-	if c.AppID == nil {
-		return fmt.Errorf("AppID is required, but missing")
+	if c.AppID == nil || *c.AppID == "" {
+		errs = append(errs, &FieldError{Field: "AppID", Err: ErrMissingAppID})
 	}
 	if c.AuthMechanism == nil {
-		return fmt.Errorf("Auth Provider is required, but missing")
-	}
-
-	switch *(c.AuthMechanism) {
-	case "anon-user":
-		c.Credential = nil
-	case "local-userpass":
-		if c.Credential.Username == nil || c.Credential.Password == nil || c.Credential.Key != nil || c.Credential.Token != nil {
-			return fmt.Errorf("Wrong creds format for local-userpass")
-		}
-	case "oauth2-google":
-		if c.Credential.Username != nil || c.Credential.Password != nil || c.Credential.Key == nil || c.Credential.Token != nil {
-			return fmt.Errorf("Wrong creds format for oauth2-google")
-		}
-
-	case "key":
-		if c.Credential.Username != nil || c.Credential.Password != nil || c.Credential.Key == nil || c.Credential.Token != nil {
-			return fmt.Errorf("Wrong creds format for key")
-		}
-	case "custom-token":
-		if c.Credential.Username != nil || c.Credential.Password != nil || c.Credential.Key != nil || c.Credential.Token == nil {
-			return fmt.Errorf("Wrong creds format for custom-token")
-		}
-	// case "jwtTokenString" :
-
-	default:
-		return fmt.Errorf("Auth Provider is not supported")
+		errs = append(errs, &FieldError{Field: "AuthMechanism", Err: ErrMissingProvider})
+	} else if p, ok := LookupProvider(c.ProviderName()); !ok {
+		errs = append(errs, &FieldError{Field: "AuthMechanism", Err: ErrUnsupportedProvider, Expected: "one of " + strings.Join(ProviderNames(), ", ")})
+	} else if c.ProviderName() != "anon-user" {
+		errs = append(errs, credentialErrors(p, c.Credential)...)
+	}
+	errs = append(errs, validateURL("BaseURL", c.BaseURL)...)
+	errs = append(errs, validateURL("WebhookBaseURL", c.WebhookBaseURL)...)
+	if p := c.ReauthPolicy; p != nil && *p != ReauthNone && *p != ReauthRefresh && *p != ReauthLogin {
+		errs = append(errs, &FieldError{Field: "ReauthPolicy", Err: ErrUnsupportedReauthPolicy, Expected: "one of " + strings.Join([]string{ReauthNone, ReauthRefresh, ReauthLogin}, ", ")})
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// validateURL checks an optional base url is absolute.
+func validateURL(name string, u *string) []*FieldError {
+	if u == nil {
+		return nil
+	}
+	parsed, err := url.Parse(*u)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return []*FieldError{{Field: name, Err: ErrInvalidURL, Expected: fmt.Sprintf("e.g. %s, got %q", RealmBaseURL, *u)}}
 	}
 	return nil
 }
@@ -1,30 +1,429 @@
 package options_test
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/sirupsen/logrus"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	. "github.com/desteves/realm/pkg/options"
 )
 
+// inHouseProvider is a provider of the application logging in with the username only.
+type inHouseProvider struct{}
+
+func (inHouseProvider) Name() string { return "in-house" }
+
+func (inHouseProvider) Validate(cred *Credential) error {
+	if cred == nil || cred.Username == nil {
+		return ErrMissingCredential
+	}
+	return nil
+}
+
+func (inHouseProvider) LoginPayload(cred *Credential) (interface{}, error) {
+	return map[string]string{"user": *cred.Username}, nil
+}
+
 var _ = Describe("Options", func() {
 	Context("Validate", func() {
-		// var appid string
-		// var authm string
-		// var creds Credential
-		// var cred1 string
-		// var cred2 string
+		var appid string
+		var authm string
+		var creds Credential
+		var cred1 string
+		var cred2 string
+		var opts ClientOptions
 		BeforeEach(func() {
-
+			appid = "graphqlserver-lrnqt"
+			authm = "local-userpass"
+			cred1 = "diana"
+			cred2 = "secret"
+			creds = Credential{Username: &cred1, Password: &cred2}
+			opts = ClientOptions{AppID: &appid, AuthMechanism: &authm, Credential: &creds}
 		})
 
 		It("should error", func() {
+			opts.AppID = nil
+			opts.Credential = &Credential{Username: &cred1, Token: &cred2}
+			err := opts.Validate()
+			Expect(err).Should(HaveOccurred())
+
+			var verr *ValidationError
+			Expect(errors.As(err, &verr)).Should(BeTrue())
+			Expect(verr.Errors).Should(HaveLen(3))
+			Expect(errors.Is(err, ErrMissingAppID)).Should(BeTrue())
+			Expect(errors.Is(err, ErrMissingCredential)).Should(BeTrue())
+			Expect(errors.Is(err, ErrUnexpectedCredential)).Should(BeTrue())
+			Expect(err.Error()).Should(ContainSubstring("Credential.Password"))
+			Expect(err.Error()).Should(ContainSubstring("Credential.Token"))
+			Expect(err.Error()).Should(ContainSubstring("local-userpass expects Credential{Username, Password}"))
+		})
 
+		It("should not panic without a credential", func() {
+			opts.Credential = nil
+			err := opts.Validate()
+			Expect(errors.Is(err, ErrMissingCredential)).Should(BeTrue())
+		})
+
+		It("should report unsupported providers", func() {
+			authm = "magic-link"
+			err := opts.Validate()
+			Expect(errors.Is(err, ErrUnsupportedProvider)).Should(BeTrue())
+			Expect(errors.Is(err, ErrMissingAppID)).Should(BeFalse())
+		})
+
+		It("should accept either an auth code or an id token for google", func() {
+			authm = "oauth2-google"
+			opts.Credential = &Credential{Key: &cred1}
+			Expect(opts.Validate()).Should(Succeed())
+			opts.Credential = &Credential{Token: &cred2}
+			Expect(opts.Validate()).Should(Succeed())
+			opts.Credential = &Credential{Key: &cred1, Token: &cred2}
+			Expect(errors.Is(opts.Validate(), ErrUnexpectedCredential)).Should(BeTrue())
+			opts.Credential = nil
+			Expect(errors.Is(opts.Validate(), ErrMissingCredential)).Should(BeTrue())
+		})
+
+		It("should require a payload for custom-function", func() {
+			authm = "custom-function"
+			Expect(errors.Is(opts.Validate(), ErrUnexpectedCredential)).Should(BeTrue())
+			opts.Credential = FunctionCredential(map[string]interface{}{"pin": 1234})
+			Expect(opts.Validate()).Should(Succeed())
+			opts.Credential = &Credential{}
+			Expect(errors.Is(opts.Validate(), ErrMissingCredential)).Should(BeTrue())
+
+			authm = "custom-token"
+			opts.Credential = &Credential{Token: &cred1, Payload: map[string]interface{}{"pin": 1234}}
+			Expect(errors.Is(opts.Validate(), ErrUnexpectedCredential)).Should(BeTrue())
+		})
+
+		It("should accept server and user api keys", func() {
+			authm = "api-key"
+			opts.Credential = ServerAPIKey("server-key")
+			Expect(opts.Validate()).Should(Succeed())
+			opts.Credential = UserAPIKey("user-key")
+			Expect(opts.Validate()).Should(Succeed())
+			Expect(opts.Credential).Should(Equal(ServerAPIKey("user-key")))
+		})
+
+		It("should read the deprecated key provider as api-key", func() {
+			Expect(opts.Deprecations()).Should(BeEmpty())
+			authm = "key"
+			opts.Credential = ServerAPIKey("server-key")
+			Expect(opts.Validate()).Should(Succeed())
+			Expect(*opts.AuthMechanism).Should(Equal("key"))
+			Expect(opts.ProviderName()).Should(Equal("api-key"))
+			Expect(opts.Deprecations()).Should(ConsistOf(ContainSubstring(`"key" provider is deprecated`)))
+			Expect(ProviderNames()).ShouldNot(ContainElement("key"))
+		})
+
+		It("should accept registered providers", func() {
+			authm = "in-house"
+			Expect(errors.Is(opts.Validate(), ErrUnsupportedProvider)).Should(BeTrue())
+			RegisterProvider(inHouseProvider{})
+			defer UnregisterProvider("in-house")
+			Expect(opts.Validate()).Should(Succeed())
+			Expect(ProviderNames()).Should(ContainElement("in-house"))
+
+			p, ok := LookupProvider("in-house")
+			Expect(ok).Should(BeTrue())
+			payload, err := p.LoginPayload(opts.Credential)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(payload).Should(Equal(map[string]string{"user": "diana"}))
+		})
+
+		It("should forget unregistered providers", func() {
+			authm = "in-house"
+			RegisterProvider(inHouseProvider{})
+			UnregisterProvider("in-house")
+			Expect(errors.Is(opts.Validate(), ErrUnsupportedProvider)).Should(BeTrue())
+			Expect(ProviderNames()).ShouldNot(ContainElement("in-house"))
+		})
+
+		It("should reject unknown reauthentication policies", func() {
+			policy := "always"
+			opts.ReauthPolicy = &policy
+			Expect(errors.Is(opts.Validate(), ErrUnsupportedReauthPolicy)).Should(BeTrue())
+			policy = ReauthRefresh
+			Expect(opts.Validate()).Should(Succeed())
 		})
 
 		It("should pass", func() {
+			Expect(opts.Validate()).Should(Succeed())
+
+			authm = "anon-user"
+			Expect(opts.Validate()).Should(Succeed())
+			Expect(opts.Credential).ShouldNot(BeNil())
+		})
+
+	})
+	Context("URLs", func() {
+		var opts ClientOptions
+		BeforeEach(func() {
+			appid := "graphqlserver-lrnqt"
+			opts = ClientOptions{AppID: &appid}
+		})
+		It("should default to the stitch hosts", func() {
+			Expect(opts.ClientAPIURL()).Should(Equal("https://stitch.mongodb.com/api/client/v2.0"))
+			Expect(opts.AppURL()).Should(Equal("https://stitch.mongodb.com/api/client/v2.0/app/graphqlserver-lrnqt"))
+			Expect(opts.WebhookAppURL()).Should(Equal("https://webhooks.mongodb-stitch.com/api/client/v2.0/app/graphqlserver-lrnqt"))
+		})
+		It("should derive every endpoint from the base urls", func() {
+			base := RealmBaseURL + "/"
+			webhooks := RealmWebhookBaseURL
+			opts.BaseURL = &base
+			opts.WebhookBaseURL = &webhooks
+			Expect(opts.AppURL()).Should(Equal("https://realm.mongodb.com/api/client/v2.0/app/graphqlserver-lrnqt"))
+			Expect(opts.WebhookAppURL()).Should(Equal("https://webhooks.mongodb-realm.com/api/client/v2.0/app/graphqlserver-lrnqt"))
+		})
+		It("should reject relative base urls", func() {
+			auth := "anon-user"
+			base := "realm.mongodb.com"
+			opts.AuthMechanism = &auth
+			opts.BaseURL = &base
+			Expect(errors.Is(opts.Validate(), ErrInvalidURL)).Should(BeTrue())
+		})
+	})
+	Context("LoadFile", func() {
+		var dir string
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "options")
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+		write := func(name, content string) string {
+			path := filepath.Join(dir, name)
+			Expect(ioutil.WriteFile(path, []byte(content), 0600)).Should(Succeed())
+			return path
+		}
+		It("should read YAML files", func() {
+			path := write("realm.yaml", "appid: graphqlserver-lrnqt\nprovider: local-userpass\ncredential:\n  username: diana\n  password: secret\nbaseurl: https://realm.mongodb.com\n")
+			opts, err := LoadFile(path)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(*opts.AppID).Should(Equal("graphqlserver-lrnqt"))
+			Expect(*opts.AuthMechanism).Should(Equal("local-userpass"))
+			Expect(*opts.Credential.Username).Should(Equal("diana"))
+			Expect(*opts.BaseURL).Should(Equal(RealmBaseURL))
+		})
+		It("should read JSON files", func() {
+			path := write("realm.json", `{"app_id": "graphqlserver-lrnqt", "provider": "custom-token", "credential": {"token": "jwt"}, "discover_location": true}`)
+			opts, err := LoadFile(path)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(*opts.AppID).Should(Equal("graphqlserver-lrnqt"))
+			Expect(*opts.Credential.Token).Should(Equal("jwt"))
+			Expect(*opts.DiscoverLocation).Should(BeTrue())
+		})
+		It("should read custom-function payloads", func() {
+			path := write("realm.yaml", "appid: graphqlserver-lrnqt\nprovider: custom-function\ncredential:\n  payload:\n    device: {serial: A42, pin: 1234}\n")
+			opts, err := LoadFile(path)
+			Expect(err).ShouldNot(HaveOccurred())
+			b, err := json.Marshal(opts.Credential.Payload)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(b).Should(MatchJSON(`{"device": {"serial": "A42", "pin": 1234}}`))
+		})
+		It("should reject other extensions", func() {
+			_, err := LoadFile(write("realm.toml", `appid = "graphqlserver-lrnqt"`))
+			Expect(err).Should(HaveOccurred())
+		})
+		It("should report malformed files", func() {
+			_, err := LoadFile(write("realm.json", `{"app_id": `))
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+	Context("FromEnv", func() {
+		vars := map[string]string{
+			"TEST_REALM_APP_ID":             "graphqlserver-lrnqt",
+			"TEST_REALM_PROVIDER":           "local-userpass",
+			"TEST_REALM_USERNAME":           "diana",
+			"TEST_REALM_PASSWORD":           "secret",
+			"TEST_REALM_ALLOW_PARTIAL_DATA": "true",
+			"TEST_REALM_REAUTH_POLICY":      "none",
+		}
+		BeforeEach(func() {
+			for k, v := range vars {
+				os.Setenv(k, v)
+			}
+		})
+		AfterEach(func() {
+			for k := range vars {
+				os.Unsetenv(k)
+			}
+			os.Unsetenv("TEST_REALM_DISCOVER_LOCATION")
+		})
+		It("should read the prefixed variables", func() {
+			opts, err := FromEnv("TEST_REALM")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(*opts.AppID).Should(Equal("graphqlserver-lrnqt"))
+			Expect(*opts.AuthMechanism).Should(Equal("local-userpass"))
+			Expect(*opts.Credential.Username).Should(Equal("diana"))
+			Expect(*opts.Credential.Password).Should(Equal("secret"))
+			Expect(*opts.AllowPartialData).Should(BeTrue())
+			Expect(*opts.ReauthPolicy).Should(Equal(ReauthNone))
+			Expect(opts.Credential.Key).Should(BeNil())
+			Expect(opts.BaseURL).Should(BeNil())
+		})
+		It("should leave the credential nil without credential variables", func() {
+			opts, err := FromEnv("TEST_OTHER_")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(opts.AppID).Should(BeNil())
+			Expect(opts.Credential).Should(BeNil())
+		})
+		It("should reject malformed booleans", func() {
+			os.Setenv("TEST_REALM_DISCOVER_LOCATION", "sometimes")
+			_, err := FromEnv("TEST_REALM")
+			Expect(err).Should(HaveOccurred())
+		})
+		It("should read every field with an env tag", func() {
+			for _, t := range []reflect.Type{reflect.TypeOf(ClientOptions{}), reflect.TypeOf(Credential{})} {
+				for i := 0; i < t.NumField(); i++ {
+					f := t.Field(i)
+					name, ok := f.Tag.Lookup("env")
+					Expect(ok).Should(BeTrue(), "%s.%s needs an env tag, - if it cannot be read from the environment", t.Name(), f.Name)
+					if name != "" && name != "-" {
+						os.Setenv("TEST_ALL_"+name, "true")
+						defer os.Unsetenv("TEST_ALL_" + name)
+					}
+				}
+			}
+			opts, err := FromEnv("TEST_ALL")
+			Expect(err).ShouldNot(HaveOccurred())
+			for _, v := range []reflect.Value{reflect.ValueOf(opts).Elem(), reflect.ValueOf(opts.Credential).Elem()} {
+				for i := 0; i < v.NumField(); i++ {
+					if v.Type().Field(i).Tag.Get("env") != "-" {
+						Expect(v.Field(i).IsNil()).Should(BeFalse(), "%s was not read", v.Type().Field(i).Name)
+					}
+				}
+			}
+		})
+	})
+	Context("MergeClientOptions", func() {
+		It("should apply file < env < explicit", func() {
+			fileApp, envApp := "from-file", "from-env"
+			fileProvider, explicitProvider := "anon-user", "local-userpass"
+			username, password := "diana", "secret"
+			base := RealmBaseURL
+			file := &ClientOptions{AppID: &fileApp, AuthMechanism: &fileProvider, BaseURL: &base, Credential: &Credential{Username: &username}}
+			env := &ClientOptions{AppID: &envApp, Credential: &Credential{Password: &password}}
+			explicit := &ClientOptions{AuthMechanism: &explicitProvider}
+
+			opts := MergeClientOptions(file, env, nil, explicit)
+			Expect(*opts.AppID).Should(Equal("from-env"))
+			Expect(*opts.AuthMechanism).Should(Equal("local-userpass"))
+			Expect(*opts.BaseURL).Should(Equal(RealmBaseURL))
+			Expect(*opts.Credential.Username).Should(Equal("diana"))
+			Expect(*opts.Credential.Password).Should(Equal("secret"))
+			Expect(file.Credential.Password).Should(BeNil())
+		})
+		It("should merge every field", func() {
+			var full ClientOptions
+			v := reflect.ValueOf(&full).Elem()
+			for i := 0; i < v.NumField(); i++ {
+				if v.Field(i).Kind() == reflect.Ptr {
+					v.Field(i).Set(reflect.New(v.Field(i).Type().Elem()))
+				}
+			}
+			full.Credential.Payload = "payload"
+			full.Logger = logrus.New()
+			merged := MergeClientOptions(&ClientOptions{}, &full)
+			m := reflect.ValueOf(merged).Elem()
+			for i := 0; i < m.NumField(); i++ {
+				Expect(m.Field(i).IsNil()).Should(BeFalse(), "%s was not merged", m.Type().Field(i).Name)
+			}
+			Expect(merged.Credential.Payload).Should(Equal("payload"))
+		})
+	})
+	Context("Secrets", func() {
+		var dir string
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "secrets")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "realm-key"), []byte("file-secret\n"), 0600)).Should(Succeed())
+			os.Setenv("TEST_REALM_API_KEY", "env-secret")
+		})
+		AfterEach(func() {
+			os.RemoveAll(dir)
+			os.Unsetenv("TEST_REALM_API_KEY")
+		})
+		It("should resolve file and env references", func() {
+			username := "diana"
+			password := "file:" + filepath.Join(dir, "realm-key")
+			key := "env:TEST_REALM_API_KEY"
+			cred := &Credential{Username: &username, Password: &password, Key: &key}
+			resolved, err := cred.Resolve()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(*resolved.Username).Should(Equal("diana"))
+			username = "env:diana"
+			resolved, err = cred.Resolve()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(*resolved.Username).Should(Equal("env:diana"))
+			Expect(*resolved.Password).Should(Equal("file-secret"))
+			Expect(*resolved.Key).Should(Equal("env-secret"))
+			Expect(*cred.Password).Should(HavePrefix("file:"))
+		})
+		It("should fail on missing secrets", func() {
+			missing := "env:TEST_REALM_MISSING"
+			_, err := (&Credential{Token: &missing}).Resolve()
+			Expect(err).Should(HaveOccurred())
+			missing = "file:" + filepath.Join(dir, "missing")
+			_, err = (&Credential{Token: &missing}).Resolve()
+			Expect(err).Should(HaveOccurred())
+		})
+		It("should redact plaintext secrets when printed or marshalled", func() {
+			appid := "graphqlserver-lrnqt"
+			username := "diana"
+			password := "hunter2"
+			key := "env:TEST_REALM_API_KEY"
+			opts := ClientOptions{AppID: &appid, Credential: &Credential{Username: &username, Password: &password, Key: &key}}
+
+			for _, out := range []string{fmt.Sprintf("%+v", opts), fmt.Sprintf("%v", &opts), fmt.Sprintf("%#v", *opts.Credential), opts.Credential.String()} {
+				Expect(out).ShouldNot(ContainSubstring("hunter2"))
+				Expect(out).Should(ContainSubstring("diana"))
+				Expect(out).Should(ContainSubstring("env:TEST_REALM_API_KEY"))
+			}
 
+			b, err := json.Marshal(opts)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(b).Should(MatchJSON(`{"app_id":"graphqlserver-lrnqt","credential":{"username":"diana","password":"REDACTED","key":"env:TEST_REALM_API_KEY"}}`))
+
+			opts.Credential = FunctionCredential(map[string]string{"pin": "hunter2"})
+			Expect(fmt.Sprint(opts)).ShouldNot(ContainSubstring("hunter2"))
+			b, err = json.Marshal(opts.Credential)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(b).Should(MatchJSON(`{"payload":"REDACTED"}`))
 		})
+		It("should write options which LoadFile reads back", func() {
+			appid := "graphqlserver-lrnqt"
+			username := "diana"
+			password := "hunter2"
+			key := "env:TEST_REALM_API_KEY"
+			opts := &ClientOptions{AppID: &appid, Credential: &Credential{Username: &username, Password: &password, Key: &key}}
 
+			for _, name := range []string{"realm.json", "realm.yaml"} {
+				path := filepath.Join(dir, name)
+				Expect(WriteFile(path, opts)).Should(Succeed())
+				info, err := os.Stat(path)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(info.Mode().Perm()).Should(Equal(os.FileMode(0600)))
+				loaded, err := LoadFile(path)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(*loaded.AppID).Should(Equal("graphqlserver-lrnqt"))
+				Expect(*loaded.Credential.Username).Should(Equal("diana"))
+				Expect(*loaded.Credential.Password).Should(Equal("hunter2"))
+				Expect(*loaded.Credential.Key).Should(Equal("env:TEST_REALM_API_KEY"))
+			}
+			Expect(WriteFile(filepath.Join(dir, "realm.toml"), opts)).Should(HaveOccurred())
+		})
 	})
 })
@@ -0,0 +1,210 @@
+package options
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Provider is a Realm authentication provider. It knows which credential fields it needs
+// and how to turn them into the body of the login request.
+type Provider interface {
+	// Name is the provider name used in the login url, e.g. local-userpass
+	Name() string
+	// Validate checks the credential has the shape expected by the provider.
+	Validate(cred *Credential) error
+	// LoginPayload builds the body of the login request. The credential secrets are already resolved.
+	LoginPayload(cred *Credential) (interface{}, error)
+}
+
+// CredentialValidator checks a credential has the shape expected by a provider,
+// returning the problems found or nil.
+type CredentialValidator func(cred *Credential) []*FieldError
+
+// The single registry of providers, used both by Validate and at login.
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]Provider{}
+)
+
+func init() {
+	for _, p := range []*builtinProvider{
+		{name: "anon-user", validate: requireFields("anon-user"), payload: func(*Credential) interface{} {
+			return map[string]interface{}{}
+		}},
+		{name: "local-userpass", validate: requireFields("local-userpass", "Username", "Password"), payload: func(cred *Credential) interface{} {
+			return map[string]interface{}{"username": *cred.Username, "password": *cred.Password}
+		}},
+		{name: "api-key", validate: requireFields("api-key", "Key"), payload: func(cred *Credential) interface{} {
+			return map[string]interface{}{"key": *cred.Key}
+		}},
+		{name: "custom-token", validate: requireFields("custom-token", "Token"), payload: func(cred *Credential) interface{} {
+			return map[string]interface{}{"token": *cred.Token}
+		}},
+		{name: "custom-function", validate: requireFields("custom-function", "Payload"), payload: func(cred *Credential) interface{} {
+			return cred.Payload
+		}},
+		{name: "oauth2-google", validate: requireOneOf("oauth2-google", "Key", "Token"), payload: func(cred *Credential) interface{} {
+			if cred.Key != nil { // auth code
+				return map[string]interface{}{"authCode": *cred.Key}
+			}
+			return map[string]interface{}{"id_token": *cred.Token}
+		}},
+		{name: "oauth2-apple", validate: requireFields("oauth2-apple", "Token"), payload: func(cred *Credential) interface{} {
+			return map[string]interface{}{"id_token": *cred.Token}
+		}},
+		{name: "oauth2-facebook", validate: requireFields("oauth2-facebook", "Token"), payload: func(cred *Credential) interface{} {
+			return map[string]interface{}{"accessToken": *cred.Token}
+		}},
+	} {
+		providers[p.name] = p
+	}
+}
+
+// RegisterProvider adds a provider, or replaces the one with the same name, so ClientOptions
+// using its name pass validation and log in with its payload.
+func RegisterProvider(p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[p.Name()] = p
+}
+
+// UnregisterProvider removes the provider registered under name, if any.
+func UnregisterProvider(name string) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	delete(providers, name)
+}
+
+// LookupProvider returns the provider registered under name.
+func LookupProvider(name string) (Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	p, ok := providers[name]
+	return p, ok
+}
+
+// ProviderNames returns the sorted names of the registered providers.
+func ProviderNames() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// builtinProvider is one of the providers Realm ships with.
+type builtinProvider struct {
+	name     string
+	validate CredentialValidator
+	payload  func(cred *Credential) interface{}
+}
+
+func (p *builtinProvider) Name() string {
+	return p.name
+}
+
+func (p *builtinProvider) Validate(cred *Credential) error {
+	if errs := p.validate(cred); len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+func (p *builtinProvider) LoginPayload(cred *Credential) (interface{}, error) {
+	if err := p.Validate(cred); err != nil {
+		return nil, err
+	}
+	if cred == nil {
+		cred = &Credential{}
+	}
+	return p.payload(cred), nil
+}
+
+// credentialErrors returns the problems the provider finds with the credential, as field errors.
+func credentialErrors(p Provider, cred *Credential) []*FieldError {
+	err := p.Validate(cred)
+	if err == nil {
+		return nil
+	}
+	if verr, ok := err.(*ValidationError); ok {
+		return verr.Errors
+	}
+	if ferr, ok := err.(*FieldError); ok {
+		return []*FieldError{ferr}
+	}
+	return []*FieldError{{Field: "Credential", Err: err}}
+}
+
+// credentialField is a named Credential field.
+type credentialField struct {
+	name string
+	set  bool
+}
+
+func credentialFields(cred *Credential) []credentialField {
+	if cred == nil {
+		cred = &Credential{}
+	}
+	return []credentialField{
+		{"Username", cred.Username != nil},
+		{"Password", cred.Password != nil},
+		{"Key", cred.Key != nil},
+		{"Token", cred.Token != nil},
+		{"Payload", cred.Payload != nil},
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// requireFields validates the credential has exactly the required fields set.
+func requireFields(provider string, required ...string) CredentialValidator {
+	expected := fmt.Sprintf("%s expects Credential{%s}", provider, strings.Join(required, ", "))
+	return func(cred *Credential) []*FieldError {
+		var errs []*FieldError
+		for _, f := range credentialFields(cred) {
+			isRequired := contains(required, f.name)
+			if isRequired && !f.set {
+				errs = append(errs, &FieldError{Field: "Credential." + f.name, Err: ErrMissingCredential, Expected: expected})
+			}
+			if !isRequired && f.set {
+				errs = append(errs, &FieldError{Field: "Credential." + f.name, Err: ErrUnexpectedCredential, Expected: expected})
+			}
+		}
+		return errs
+	}
+}
+
+// requireOneOf validates the credential has exactly one of the fields set.
+func requireOneOf(provider string, fields ...string) CredentialValidator {
+	expected := fmt.Sprintf("%s expects Credential{%s}", provider, strings.Join(fields, " or "))
+	return func(cred *Credential) []*FieldError {
+		var errs []*FieldError
+		set := 0
+		for _, f := range credentialFields(cred) {
+			if !f.set {
+				continue
+			}
+			if !contains(fields, f.name) || set > 0 {
+				errs = append(errs, &FieldError{Field: "Credential." + f.name, Err: ErrUnexpectedCredential, Expected: expected})
+				continue
+			}
+			set++
+		}
+		if set == 0 {
+			errs = append(errs, &FieldError{Field: "Credential", Err: ErrMissingCredential, Expected: expected})
+		}
+		return errs
+	}
+}
@@ -0,0 +1,137 @@
+package options
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// The secret Credential fields (Password, Key and Token) may hold a reference to a secret instead of its value:
+//
+//	file:/var/run/secrets/realm-key   the content of the file, without the trailing newline
+//	env:REALM_API_KEY                 the value of the environment variable
+//
+// References are resolved at login time, see Credential.Resolve.
+const (
+	fileRef = "file:"
+	envRef  = "env:"
+
+	redactedValue = "REDACTED"
+)
+
+// Resolve returns a copy of the credential with the secret references replaced by their values.
+// Fields which are not references are copied as is, the Username is never resolved.
+func (c *Credential) Resolve() (*Credential, error) {
+	if c == nil {
+		return nil, nil
+	}
+	resolved := *c
+	for name, field := range map[string]**string{
+		"Password": &resolved.Password,
+		"Key":      &resolved.Key,
+		"Token":    &resolved.Token,
+	} {
+		v, err := resolveSecret(*field)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve Credential.%s: %v", name, err)
+		}
+		*field = v
+	}
+	return &resolved, nil
+}
+
+func resolveSecret(s *string) (*string, error) {
+	if s == nil {
+		return nil, nil
+	}
+	switch {
+	case strings.HasPrefix(*s, fileRef):
+		b, err := ioutil.ReadFile(strings.TrimPrefix(*s, fileRef))
+		if err != nil {
+			return nil, err
+		}
+		v := strings.TrimRight(string(b), "\r\n")
+		return &v, nil
+	case strings.HasPrefix(*s, envRef):
+		name := strings.TrimPrefix(*s, envRef)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", name)
+		}
+		return &v, nil
+	}
+	return s, nil
+}
+
+// isReference reports whether s refers to a secret rather than holding it.
+func isReference(s string) bool {
+	return strings.HasPrefix(s, fileRef) || strings.HasPrefix(s, envRef)
+}
+
+// redact hides a plaintext secret. References are kept since they are safe to show.
+func redact(s *string) *string {
+	if s == nil || isReference(*s) {
+		return s
+	}
+	r := redactedValue
+	return &r
+}
+
+// redacted returns a copy of the credential safe to print, log or marshal. Use WriteFile to write
+// options LoadFile can read back.
+func (c Credential) redacted() Credential {
+	c.Password = redact(c.Password)
+	c.Key = redact(c.Key)
+	c.Token = redact(c.Token)
+	if c.Payload != nil {
+		c.Payload = redactedValue
+	}
+	return c
+}
+
+// String implements fmt.Stringer, redacting the plaintext secrets.
+func (c Credential) String() string {
+	r := c.redacted()
+	payload := "<nil>"
+	if r.Payload != nil {
+		payload = redactedValue
+	}
+	return fmt.Sprintf("{Username:%s Password:%s Key:%s Token:%s Payload:%s}", str(r.Username), str(r.Password), str(r.Key), str(r.Token), payload)
+}
+
+// MarshalJSON implements json.Marshaler, redacting the plaintext secrets, so structured loggers do not leak them.
+func (c Credential) MarshalJSON() ([]byte, error) {
+	type credential Credential // drops the methods, avoiding the recursion
+	return json.Marshal(credential(c.redacted()))
+}
+
+// GoString implements fmt.GoStringer, so %#v is redacted too.
+func (c Credential) GoString() string {
+	return "options.Credential" + c.String()
+}
+
+// String implements fmt.Stringer, redacting the plaintext secrets of the credential.
+func (c ClientOptions) String() string {
+	cred := "<nil>"
+	if c.Credential != nil {
+		cred = c.Credential.String()
+	}
+	return fmt.Sprintf("{AppID:%s AuthMechanism:%s Credential:%s AllowPartialData:%s BaseURL:%s WebhookBaseURL:%s DiscoverLocation:%s ReauthPolicy:%s}",
+		str(c.AppID), str(c.AuthMechanism), cred, boolStr(c.AllowPartialData), str(c.BaseURL), str(c.WebhookBaseURL), boolStr(c.DiscoverLocation), str(c.ReauthPolicy))
+}
+
+func str(s *string) string {
+	if s == nil {
+		return "<nil>"
+	}
+	return *s
+}
+
+func boolStr(b *bool) string {
+	if b == nil {
+		return "<nil>"
+	}
+	return fmt.Sprint(*b)
+}